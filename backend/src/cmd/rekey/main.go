@@ -0,0 +1,35 @@
+// Command rekey gives every cached goscrape row the id derived from its
+// registration number under CACHE_ID_KEY, merging rows that belong to the same
+// student. Run it after upgrading to student ids and after changing
+// CACHE_ID_KEY:
+//
+//	go run ./src/cmd/rekey
+package main
+
+import (
+	"goscraper/src/globals"
+	"goscraper/src/helpers/databases"
+	"log"
+	"os"
+)
+
+func main() {
+	db, err := databases.NewStore()
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	if os.Getenv("CACHE_ID_KEY") == "" && !globals.DevMode {
+		log.Fatalf("CACHE_ID_KEY is not set; refusing to rekey under an empty key")
+	}
+
+	result, err := db.Rekey()
+	if err != nil {
+		log.Fatalf("Rekey failed after %d rows: %v", result.Rows, err)
+	}
+
+	log.Printf("Scanned %d rows: %d rekeyed, %d duplicates merged, %d without a registration number deleted, %d skipped",
+		result.Rows, result.Rekeyed, result.Merged, result.Orphaned, result.Skipped)
+	if result.Skipped > 0 {
+		log.Printf("Skipped rows changed during the run; run rekey again to finish them")
+	}
+}
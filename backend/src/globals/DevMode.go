@@ -1,8 +1,5 @@
 package globals
 
-import "sync"
-
 var (
-	DevMode        bool = true
-	ActiveSessions sync.Map
+	DevMode bool = true
 )
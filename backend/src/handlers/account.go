@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"goscraper/src/helpers/databases"
+	"goscraper/src/types"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const retentionCheckInterval = 24 * time.Hour
+
+// RetentionDays is how long a student may stay inactive before their data is
+// deleted, from RETENTION_DAYS. Zero disables retention.
+func RetentionDays() int {
+	if raw := os.Getenv("RETENTION_DAYS"); raw != "" {
+		if days, err := strconv.Atoi(raw); err == nil && days > 0 {
+			return days
+		}
+	}
+	return 0
+}
+
+// accountRegNumber resolves the caller's registration number, from the cache
+// row linked to their session when there is one and from the portal otherwise,
+// in which case the session is linked to the student.
+func accountRegNumber(db databases.Store, token string) (string, error) {
+	if row, err := db.FindBySession(databases.SessionHash(token)); err == nil && row != nil {
+		if regNumber, ok := row["regNumber"].(string); ok && regNumber != "" {
+			return regNumber, nil
+		}
+	}
+
+	user, err := GetUser(token)
+	if err != nil {
+		return "", err
+	}
+	if user.RegNumber == "" {
+		return "", errors.New("unable to resolve registration number")
+	}
+	if err := db.LinkSession(databases.SessionHash(token), user.RegNumber); err != nil {
+		return "", err
+	}
+	return user.RegNumber, nil
+}
+
+// ExportAccount returns everything stored about the calling student.
+func ExportAccount(token string) (*types.AccountExport, error) {
+	db, err := databases.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	regNumber, err := accountRegNumber(db, token)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &types.AccountExport{
+		ExportedAt: time.Now().UnixNano() / int64(time.Millisecond),
+		RegNumber:  regNumber,
+		Sessions:   []types.SessionExport{},
+	}
+
+	if export.Cache, err = db.FindByRegNumber(regNumber); err != nil {
+		return nil, err
+	}
+
+	sessions, err := db.StudentSessions(regNumber)
+	if err != nil {
+		return nil, err
+	}
+	current := databases.SessionHash(token)
+	for _, session := range sessions {
+		export.Sessions = append(export.Sessions, types.SessionExport{
+			CreatedAt: session.CreatedAt,
+			Current:   session.ID == current,
+		})
+	}
+
+	optOuts, err := db.GetCohortOptOuts()
+	if err != nil {
+		return nil, err
+	}
+	export.Preferences.CohortOptOut = optOuts[regNumber]
+	feed, err := db.FindFeedByRegNumber(regNumber)
+	if err != nil {
+		return nil, err
+	}
+	if feed != nil {
+		export.Preferences.CalendarFeedAt = &feed.CreatedAt
+	}
+
+	if export.Grades, err = db.GetGradeEntries(regNumber); err != nil {
+		return nil, err
+	}
+	if export.AttendanceHistory, err = db.GetAttendanceSnapshots(regNumber); err != nil {
+		return nil, err
+	}
+	if export.MarksHistory, err = db.GetMarkSnapshots(regNumber); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// DeleteAccount erases everything stored about the calling student and
+// revokes all of their sessions, including the caller's.
+func DeleteAccount(token string) error {
+	db, err := databases.NewStore()
+	if err != nil {
+		return err
+	}
+	regNumber, err := accountRegNumber(db, token)
+	if err != nil {
+		return err
+	}
+
+	db.InvalidateSession(databases.SessionHash(token))
+	if err := purgeStudent(db, regNumber); err != nil {
+		return err
+	}
+	if err := db.DeleteSession(databases.SessionHash(token)); err != nil {
+		return err
+	}
+	runJob(JobCohortRefresh)
+	return nil
+}
+
+// purgeStudent deletes a student's rows from every table.
+func purgeStudent(db databases.Store, regNumber string) error {
+	if err := db.DeleteSnapshots(regNumber); err != nil {
+		return err
+	}
+	if err := db.DeleteGrades(regNumber); err != nil {
+		return err
+	}
+	if err := db.SetCohortOptOut(regNumber, false); err != nil {
+		return err
+	}
+	if err := db.DeleteFeed(regNumber); err != nil {
+		return err
+	}
+	return db.DeleteStudent(regNumber)
+}
+
+// PurgeInactiveStudents deletes the data of every student with nothing written
+// to any table in the retention period, returning how many were deleted.
+func PurgeInactiveStudents() (int, error) {
+	days := RetentionDays()
+	if days == 0 {
+		return 0, nil
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return 0, err
+	}
+	before := time.Now().AddDate(0, 0, -days).UnixNano() / int64(time.Millisecond)
+	inactive, err := db.InactiveStudents(before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, regNumber := range inactive {
+		if err := purgeStudent(db, regNumber); err != nil {
+			log.Printf("Error purging inactive student: %v", err)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		runJob(JobCohortRefresh)
+	}
+	return purged, nil
+}
@@ -5,25 +5,45 @@ import (
 	"goscraper/src/helpers"
 	"goscraper/src/helpers/databases"
 	"goscraper/src/types"
-	"goscraper/src/utils"
+	"time"
 )
 
 func GetAttendance(token string) (*types.AttendanceResponse, error) {
-	encodedToken := utils.Encode(token)
-	db, _ := databases.NewDatabaseHelper()
-	// Always fetch fresh data
+	return getAttendance(token, true)
+}
+
+// ScrapeAttendance scrapes the attendance even when the stored copy is still fresh.
+func ScrapeAttendance(token string) (*types.AttendanceResponse, error) {
+	return getAttendance(token, false)
+}
+
+func getAttendance(token string, useStore bool) (*types.AttendanceResponse, error) {
+	sessionHash := databases.SessionHash(token)
+	db, _ := databases.NewStore()
+	if db != nil && useStore {
+		var cached types.AttendanceResponse
+		if freshness, ok := freshSection(db, sessionHash, helpers.SectionAttendance, &cached); ok {
+			helpers.AttendanceMargins(&cached)
+			cached.Freshness = freshness
+			return &cached, nil
+		}
+	}
+
+	// Nothing fresh in the store - scrape
 	scraper := helpers.NewAcademicsFetch(token)
 	attendance, err := scraper.GetAttendance()
 	if err != nil {
 		// Scrape failed - check if we have any stale data as fallback
 		if db != nil {
-			cachedData, exists, _, _ := db.GetCachedDataByKey(encodedToken, "attendance")
-			if exists {
+			cachedData, freshness, _ := db.GetCachedSection(sessionHash, helpers.SectionAttendance)
+			if cachedData != nil {
 				var attendanceResponse types.AttendanceResponse
 				if jsonData, ok := cachedData.(map[string]interface{}); ok {
 					jsonBytes, _ := json.Marshal(jsonData)
 					json.Unmarshal(jsonBytes, &attendanceResponse)
+					helpers.AttendanceMargins(&attendanceResponse)
 					attendanceResponse.Stale = true
+					attendanceResponse.Freshness = freshness
 					return &attendanceResponse, nil
 				}
 			}
@@ -31,14 +51,76 @@ func GetAttendance(token string) (*types.AttendanceResponse, error) {
 		return nil, err
 	}
 
+	helpers.AttendanceMargins(attendance)
+
+	attendance.Stale = false
+	attendance.Freshness = helpers.FreshSection(helpers.SectionAttendance)
+
 	// Scrape succeeded - update cache
 	if db != nil && attendance != nil {
 		regNumber := ""
 		if attendance.RegNumber != "" {
 			regNumber = attendance.RegNumber
 		}
-		go db.UpsertDataByKey(encodedToken, regNumber, "attendance", attendance)
+		fetchedAt := attendance.Freshness.FetchedAt
+		submitJob("cache-write", func() error {
+			return db.UpsertDataByKey(sessionHash, regNumber, helpers.SectionAttendance, attendance, fetchedAt)
+		})
+		submitJob("attendance-history", func() error {
+			return recordAttendanceSnapshot(db, attendance)
+		})
 	}
-	attendance.Stale = false
 	return attendance, nil
 }
+
+// GetAttendanceInsights returns how many classes each course needs, or can
+// spare, relative to its attendance threshold.
+func GetAttendanceInsights(token string) (*types.AttendanceInsightsResponse, error) {
+	attendance, err := GetAttendance(token)
+	if err != nil {
+		return nil, err
+	}
+	return helpers.AttendanceInsights(attendance), nil
+}
+
+// GetAttendanceForecast projects end-of-semester attendance from the working
+// days left in the planner, starting tomorrow, and the timetable.
+func GetAttendanceForecast(token string, skip int) (*types.AttendanceForecastResponse, error) {
+	attendance, err := GetAttendance(token)
+	if err != nil {
+		return nil, err
+	}
+	timetable, err := GetTimetable(token)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := GetCalendarEntries(token)
+	if err != nil {
+		return nil, err
+	}
+
+	from := time.Now().In(helpers.PlannerLocation).AddDate(0, 0, 1).Format("2006-01-02")
+	return helpers.ForecastAttendance(attendance, timetable, entries, from, helpers.SemesterEnd(entries), skip), nil
+}
+
+// GetLeaveImpact projects what a leave between two dates does to each
+// course's attendance. Courses in onDuty, or all when it holds
+// helpers.OnDutyAll, are treated as on duty for the leave.
+func GetLeaveImpact(token string, from time.Time, to time.Time, onDuty []string) (*types.LeaveImpactResponse, error) {
+	attendance, err := GetAttendance(token)
+	if err != nil {
+		return nil, err
+	}
+	timetable, err := GetTimetable(token)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := GetCalendarEntries(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Today's classes aren't in the portal's counts yet
+	today := time.Now().In(helpers.PlannerLocation).Format("2006-01-02")
+	return helpers.LeaveImpact(attendance, timetable, entries, today, from.Format("2006-01-02"), to.Format("2006-01-02"), onDuty), nil
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"goscraper/src/helpers/databases"
+	"goscraper/src/types"
+)
+
+// Sections that responses are tagged with besides the student's own cached
+// sections. Planner and cohort responses are rebuilt when these change.
+const (
+	CacheSectionCalendar = "calendar"
+	CacheSectionCohort   = "cohort"
+)
+
+// freshSection decodes a student's cached section into target when it is
+// still within its TTL, so the request is answered from the store instead of
+// a scrape.
+func freshSection(db databases.StudentCache, sessionHash string, section string, target interface{}) (*types.SectionFreshness, bool) {
+	cached, freshness, err := db.GetCachedSection(sessionHash, section)
+	hit := err == nil && cached != nil && freshness != nil && freshness.Fresh
+	if hit {
+		jsonBytes, err := json.Marshal(cached)
+		hit = err == nil && json.Unmarshal(jsonBytes, target) == nil
+	}
+	databases.Responses().RecordStoreLookup(hit)
+	return freshness, hit
+}
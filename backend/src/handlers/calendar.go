@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"goscraper/src/helpers"
+	"goscraper/src/helpers/databases"
 	"goscraper/src/types"
+	"log"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,3 +19,238 @@ func GetCalendar(token string) (*types.CalendarResponse, error) {
 	return calendar, err
 
 }
+
+const (
+	calendarWriteAttempts          = 3
+	calendarChangesLimit           = 100
+	defaultCalendarRefreshInterval = 12 * time.Hour
+)
+
+var (
+	plannerTokenMu sync.Mutex
+	plannerToken   string
+)
+
+// CalendarRefreshInterval is how often the stored planner is scraped again
+// and compared, from CALENDAR_REFRESH_INTERVAL.
+func CalendarRefreshInterval() time.Duration {
+	if raw := os.Getenv("CALENDAR_REFRESH_INTERVAL"); raw != "" {
+		if interval, err := time.ParseDuration(raw); err == nil && interval > 0 {
+			return interval
+		}
+	}
+	return defaultCalendarRefreshInterval
+}
+
+// rememberPlannerToken keeps the session of the latest calendar request in
+// memory so the refresh job can scrape the planner, which needs a login. It
+// is only used when PLANNER_SESSION_TOKEN is not set.
+func rememberPlannerToken(token string) {
+	if token == "" {
+		return
+	}
+	plannerTokenMu.Lock()
+	plannerToken = token
+	plannerTokenMu.Unlock()
+}
+
+// forgetPlannerToken drops the remembered session if it is token, so the
+// refresh job stops using a session once its user logs out.
+func forgetPlannerToken(token string) {
+	plannerTokenMu.Lock()
+	if plannerToken == token {
+		plannerToken = ""
+	}
+	plannerTokenMu.Unlock()
+}
+
+// currentPlannerToken is the session the refresh job scrapes the planner
+// with: the dedicated PLANNER_SESSION_TOKEN when set, otherwise the session
+// of the latest calendar request.
+func currentPlannerToken() string {
+	if token := strings.TrimSpace(os.Getenv("PLANNER_SESSION_TOKEN")); token != "" {
+		return token
+	}
+	plannerTokenMu.Lock()
+	defer plannerTokenMu.Unlock()
+	return plannerToken
+}
+
+// LoadCalendar returns the planner from the database, scraping and storing it
+// when the database has none. Every day is tagged with its categories.
+func LoadCalendar(token string) (*types.CalendarResponse, error) {
+	db, err := databases.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	rememberPlannerToken(token)
+
+	events, _, err := db.GetCalendarEvents(helpers.PlannerTerm())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(events) != 0 {
+		dbcal := databases.CalendarFromEvents(events)
+		helpers.ClassifyCalendar(&dbcal)
+		return &dbcal, nil
+	}
+
+	cal, err := GetCalendar(token)
+	if err != nil {
+		return nil, err
+	}
+	if cal.Error {
+		return cal, nil
+	}
+
+	if _, err := storeCalendar(db, helpers.PlannerTerm(), cal); err != nil {
+		log.Printf("Error storing calendar: %v", err)
+	}
+	helpers.ClassifyCalendar(cal)
+	return cal, nil
+}
+
+// storeCalendar replaces the stored planner of a term with a scraped one when
+// they differ, returning the days that changed. Days are not recorded as
+// changes when the term had none stored.
+func storeCalendar(db databases.CalendarStore, term string, cal *types.CalendarResponse) ([]types.CalendarChange, error) {
+	if len(cal.Calendar) == 0 {
+		return nil, errors.New("scraped planner has no days")
+	}
+
+	hash := helpers.CalendarHash(cal)
+	for attempt := 0; attempt < calendarWriteAttempts; attempt++ {
+		events, previousHash, err := db.GetCalendarEvents(term)
+		if err != nil {
+			return nil, err
+		}
+		if previousHash == hash {
+			return nil, nil
+		}
+
+		var changes []types.CalendarChange
+		if len(events) != 0 {
+			stored := databases.CalendarFromEvents(events)
+			changes = helpers.DiffCalendar(term, &stored, cal, time.Now())
+		}
+
+		replaced, err := db.ReplaceCalendarEvents(term, previousHash, hash, databases.CalendarEvents(term, cal), changes)
+		if err != nil {
+			return nil, err
+		}
+		if replaced {
+			databases.Responses().InvalidateSection(CacheSectionCalendar)
+			return changes, nil
+		}
+	}
+	return nil, errors.New("planner changed while it was being stored")
+}
+
+// RefreshCalendar scrapes the planner with the session of the latest calendar
+// request and stores it if it changed, returning the days that changed.
+func RefreshCalendar() ([]types.CalendarChange, error) {
+	token := currentPlannerToken()
+	if token == "" {
+		return nil, nil
+	}
+
+	cal, err := GetCalendar(token)
+	if err != nil {
+		return nil, err
+	}
+	if cal.Error {
+		return nil, errors.New(cal.Message)
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	return storeCalendar(db, helpers.PlannerTerm(), cal)
+}
+
+// GetCalendarChanges returns the most recent planner changes of the current
+// term, newest first.
+func GetCalendarChanges() (*types.CalendarChangesResponse, error) {
+	db, err := databases.NewStore()
+	if err != nil {
+		return nil, err
+	}
+
+	term := helpers.PlannerTerm()
+	changes, err := db.GetCalendarChanges(term, calendarChangesLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &types.CalendarChangesResponse{
+		Term:    term,
+		Changes: changes,
+		Status:  200,
+	}, nil
+}
+
+func GetCalendarEntries(token string) ([]types.CalendarEntry, error) {
+	cal, err := LoadCalendar(token)
+	if err != nil {
+		return nil, err
+	}
+	if cal.Error {
+		return nil, errors.New(cal.Message)
+	}
+	return helpers.CalendarEntries(cal), nil
+}
+
+// GetHolidays returns every holiday in the planner.
+func GetHolidays(token string) (*types.CalendarEventsResponse, error) {
+	entries, err := GetCalendarEntries(token)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []types.CalendarEntry{}
+	for _, entry := range entries {
+		if helpers.HasCategory(entry.Categories, types.DayCategoryHoliday) {
+			events = append(events, entry)
+		}
+	}
+
+	return &types.CalendarEventsResponse{
+		Type:   types.DayCategoryHoliday,
+		Events: events,
+		Status: 200,
+	}, nil
+}
+
+// GetUpcomingEvents returns planner entries from today onwards, optionally
+// restricted to a single category. A limit of zero returns everything.
+func GetUpcomingEvents(token string, category string, limit int) (*types.CalendarEventsResponse, error) {
+	entries, err := GetCalendarEntries(token)
+	if err != nil {
+		return nil, err
+	}
+
+	today := time.Now().In(helpers.PlannerLocation).Format("2006-01-02")
+	events := []types.CalendarEntry{}
+	for _, entry := range entries {
+		if entry.Date < today {
+			continue
+		}
+		if category != "" && !helpers.HasCategory(entry.Categories, category) {
+			continue
+		}
+		if category == "" && entry.Event == "" {
+			continue
+		}
+		events = append(events, entry)
+		if limit > 0 && len(events) >= limit {
+			break
+		}
+	}
+
+	return &types.CalendarEventsResponse{
+		Type:   category,
+		Events: events,
+		Status: 200,
+	}, nil
+}
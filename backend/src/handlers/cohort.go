@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"goscraper/src/helpers"
+	"goscraper/src/helpers/databases"
+	"goscraper/src/types"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCohortMinContributors = 5
+	defaultCohortRefreshInterval = 6 * time.Hour
+)
+
+var (
+	cohortMu          sync.RWMutex
+	cohortStats       map[string]types.CohortGroup
+	cohortGeneratedAt int64
+)
+
+// CohortMinContributors is the smallest number of students an aggregate must
+// cover before it is published, from COHORT_MIN_CONTRIBUTORS.
+func CohortMinContributors() int {
+	if raw := os.Getenv("COHORT_MIN_CONTRIBUTORS"); raw != "" {
+		if k, err := strconv.Atoi(raw); err == nil && k >= 2 {
+			return k
+		}
+	}
+	return defaultCohortMinContributors
+}
+
+// CohortRefreshInterval is how often cohort statistics are rebuilt, from
+// COHORT_REFRESH_INTERVAL.
+func CohortRefreshInterval() time.Duration {
+	if raw := os.Getenv("COHORT_REFRESH_INTERVAL"); raw != "" {
+		if interval, err := time.ParseDuration(raw); err == nil && interval > 0 {
+			return interval
+		}
+	}
+	return defaultCohortRefreshInterval
+}
+
+// RefreshCohortStats rebuilds the cohort statistics from every student's
+// cached attendance and marks, leaving out students who opted out.
+func RefreshCohortStats() error {
+	db, err := databases.NewStore()
+	if err != nil {
+		return err
+	}
+
+	optOuts, err := db.GetCohortOptOuts()
+	if err != nil {
+		return err
+	}
+	rows, err := db.GetCohortRows()
+	if err != nil {
+		return err
+	}
+
+	var contributions []helpers.CohortContribution
+	for _, row := range rows {
+		if row.RegNumber == "" || optOuts[row.RegNumber] {
+			continue
+		}
+		contribution := helpers.CohortContribution{
+			Attendance: row.Attendance,
+			Marks:      row.Marks,
+		}
+		if row.User != nil {
+			contribution.Section = row.User.Section
+		}
+		contributions = append(contributions, contribution)
+	}
+
+	stats := helpers.BuildCohortStats(contributions, CohortMinContributors())
+
+	cohortMu.Lock()
+	cohortStats = stats
+	cohortGeneratedAt = time.Now().UnixNano() / int64(time.Millisecond)
+	cohortMu.Unlock()
+
+	databases.Responses().InvalidateSection(CacheSectionCohort)
+	return nil
+}
+
+// GetCohort returns the published statistics of a course, across every
+// student and within the requesting student's section.
+func GetCohort(token string, courseCode string) (*types.CohortResponse, error) {
+	user, err := GetUser(token)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &types.CohortResponse{
+		CourseCode:      courseCode,
+		MinContributors: CohortMinContributors(),
+	}
+
+	cohortMu.RLock()
+	if group, ok := cohortStats[helpers.CohortKey(courseCode, "")]; ok {
+		response.Course = &group
+	}
+	if user.Section != "" {
+		if group, ok := cohortStats[helpers.CohortKey(courseCode, user.Section)]; ok {
+			response.Section = &group
+		}
+	}
+	response.GeneratedAt = cohortGeneratedAt
+	cohortMu.RUnlock()
+
+	if user.RegNumber != "" {
+		db, err := databases.NewStore()
+		if err != nil {
+			return nil, err
+		}
+		optOuts, err := db.GetCohortOptOuts()
+		if err != nil {
+			return nil, err
+		}
+		response.OptedOut = optOuts[databases.NormalizeRegNumber(user.RegNumber)]
+	}
+	return response, nil
+}
+
+// SetCohortOptOut excludes the student from cohort statistics, or includes
+// them again. Opting out rebuilds the statistics straight away.
+func SetCohortOptOut(token string, optOut bool) error {
+	user, err := GetUser(token)
+	if err != nil {
+		return err
+	}
+	if user.RegNumber == "" {
+		return errors.New("unable to resolve registration number")
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return err
+	}
+	if err := db.SetCohortOptOut(user.RegNumber, optOut); err != nil {
+		return err
+	}
+	db.InvalidateSession(databases.SessionHash(token))
+	if optOut {
+		runJob(JobCohortRefresh)
+	}
+	return nil
+}
@@ -5,25 +5,42 @@ import (
 	"goscraper/src/helpers"
 	"goscraper/src/helpers/databases"
 	"goscraper/src/types"
-	"goscraper/src/utils"
 )
 
 func GetCourses(token string) (*types.CourseResponse, error) {
-	encodedToken := utils.Encode(token)
-	db, _ := databases.NewDatabaseHelper()
-	// Always fetch fresh data
+	return getCourses(token, true)
+}
+
+// ScrapeCourses scrapes the courses even when the stored copy is still fresh.
+func ScrapeCourses(token string) (*types.CourseResponse, error) {
+	return getCourses(token, false)
+}
+
+func getCourses(token string, useStore bool) (*types.CourseResponse, error) {
+	sessionHash := databases.SessionHash(token)
+	db, _ := databases.NewStore()
+	if db != nil && useStore {
+		var cached types.CourseResponse
+		if freshness, ok := freshSection(db, sessionHash, helpers.SectionCourses, &cached); ok {
+			cached.Freshness = freshness
+			return &cached, nil
+		}
+	}
+
+	// Nothing fresh in the store - scrape
 	scraper := helpers.NewCoursePage(token)
 	course, err := scraper.GetCourses()
 	if err != nil {
 		// Scrape failed - check if we have any stale data as fallback
 		if db != nil {
-			cachedData, exists, _, _ := db.GetCachedDataByKey(encodedToken, "courses")
-			if exists {
+			cachedData, freshness, _ := db.GetCachedSection(sessionHash, helpers.SectionCourses)
+			if cachedData != nil {
 				var courseResponse types.CourseResponse
 				if jsonData, ok := cachedData.(map[string]interface{}); ok {
 					jsonBytes, _ := json.Marshal(jsonData)
 					json.Unmarshal(jsonBytes, &courseResponse)
 					courseResponse.Stale = true
+					courseResponse.Freshness = freshness
 					return &courseResponse, nil
 				}
 			}
@@ -31,14 +48,19 @@ func GetCourses(token string) (*types.CourseResponse, error) {
 		return nil, err
 	}
 
+	course.Stale = false
+	course.Freshness = helpers.FreshSection(helpers.SectionCourses)
+
 	// Scrape succeeded - update cache
 	if db != nil && course != nil {
 		regNumber := ""
 		if course.RegNumber != "" {
 			regNumber = course.RegNumber
 		}
-		go db.UpsertDataByKey(encodedToken, regNumber, "courses", course)
+		fetchedAt := course.Freshness.FetchedAt
+		submitJob("cache-write", func() error {
+			return db.UpsertDataByKey(sessionHash, regNumber, helpers.SectionCourses, course, fetchedAt)
+		})
 	}
-	course.Stale = false
 	return course, nil
 }
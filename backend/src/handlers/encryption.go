@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"goscraper/src/helpers/databases"
+	"os"
+	"time"
+)
+
+const defaultReencryptInterval = 24 * time.Hour
+
+// ReencryptInterval is how often cached, history and grade rows are checked
+// for values that aren't sealed with the active key, from
+// ENCRYPTION_MIGRATE_INTERVAL.
+func ReencryptInterval() time.Duration {
+	if raw := os.Getenv("ENCRYPTION_MIGRATE_INTERVAL"); raw != "" {
+		if interval, err := time.ParseDuration(raw); err == nil && interval > 0 {
+			return interval
+		}
+	}
+	return defaultReencryptInterval
+}
+
+// ReencryptCache moves every cached section, history snapshot and grade onto
+// the active encryption key, encrypting plaintext rows and rows sealed with a
+// retired key.
+func ReencryptCache() (databases.ReencryptResult, error) {
+	db, err := databases.NewStore()
+	if err != nil {
+		return databases.ReencryptResult{}, err
+	}
+	return db.Reencrypt()
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"goscraper/src/helpers"
+	"goscraper/src/helpers/databases"
+	"goscraper/src/types"
+)
+
+// GetGPA computes the SGPA of every semester and the CGPA. Past semesters
+// come from the grades the student entered; the current semester uses the
+// scraped course credits with grades from whatIf, keyed by course code, or
+// entered for the semester.
+func GetGPA(token string, whatIf map[string]string) (*types.GPAResponse, error) {
+	user, err := GetUser(token)
+	if err != nil {
+		return nil, err
+	}
+	if user.RegNumber == "" {
+		return nil, errors.New("unable to resolve registration number")
+	}
+
+	courses, err := GetCourses(token)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	entered, err := db.GetGradeEntries(user.RegNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	current := helpers.CurrentSemesterGrades(courses.Courses, entered[user.Semester], whatIf)
+	gpa := helpers.BuildGPA(user.RegNumber, user.Semester, entered, current)
+	gpa.Stale = courses.Stale
+	return gpa, nil
+}
+
+// SaveSemesterGrades stores the student's grades for a semester, replacing
+// any entered before.
+func SaveSemesterGrades(token string, semester int, entries []types.GradeEntry) (*types.GPAResponse, error) {
+	user, err := GetUser(token)
+	if err != nil {
+		return nil, err
+	}
+	if user.RegNumber == "" {
+		return nil, errors.New("unable to resolve registration number")
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.ReplaceSemesterGrades(user.RegNumber, semester, entries); err != nil {
+		return nil, err
+	}
+	return GetGPA(token, nil)
+}
+
+// DeleteSemesterGrades removes the grades the student entered for a semester.
+func DeleteSemesterGrades(token string, semester int) error {
+	user, err := GetUser(token)
+	if err != nil {
+		return err
+	}
+	if user.RegNumber == "" {
+		return errors.New("unable to resolve registration number")
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return err
+	}
+	return db.DeleteSemesterGrades(user.RegNumber, semester)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"goscraper/src/helpers"
+	"goscraper/src/helpers/databases"
+	"goscraper/src/types"
+	"time"
+)
+
+// recordAttendanceSnapshot stores the courses whose attendance changed since
+// the student's last snapshot.
+func recordAttendanceSnapshot(db databases.HistoryStore, attendance *types.AttendanceResponse) error {
+	if attendance == nil || attendance.RegNumber == "" {
+		return nil
+	}
+
+	snapshots, err := db.GetAttendanceSnapshots(attendance.RegNumber)
+	if err != nil {
+		return err
+	}
+
+	changed := helpers.ChangedAttendanceSnapshots(helpers.LatestAttendanceSnapshots(snapshots), attendance, time.Now())
+	return db.AddAttendanceSnapshots(changed)
+}
+
+// GetAttendanceHistory returns the attendance series of every course and the
+// changes between snapshots, including the scrape made for this request.
+func GetAttendanceHistory(token string) (*types.AttendanceHistoryResponse, error) {
+	attendance, err := GetAttendance(token)
+	if err != nil {
+		return nil, err
+	}
+	if attendance.RegNumber == "" {
+		return nil, errors.New("unable to resolve registration number")
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := db.GetAttendanceSnapshots(attendance.RegNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	// The snapshot for this scrape may still be being written
+	if !attendance.Stale {
+		snapshots = append(snapshots, helpers.ChangedAttendanceSnapshots(helpers.LatestAttendanceSnapshots(snapshots), attendance, time.Now())...)
+	}
+
+	courses, events := helpers.AttendanceHistory(snapshots, attendance)
+	return &types.AttendanceHistoryResponse{
+		RegNumber: attendance.RegNumber,
+		Courses:   courses,
+		Events:    events,
+		Stale:     attendance.Stale,
+	}, nil
+}
+
+// recordMarksSnapshot stores the tests that were published or rescored since
+// the student's last snapshot.
+func recordMarksSnapshot(db databases.HistoryStore, marks *types.MarksResponse) error {
+	if marks == nil || marks.RegNumber == "" {
+		return nil
+	}
+
+	snapshots, err := db.GetMarkSnapshots(marks.RegNumber)
+	if err != nil {
+		return err
+	}
+
+	changed := helpers.ChangedMarkSnapshots(helpers.LatestMarkSnapshots(snapshots), marks, time.Now())
+	return db.AddMarkSnapshots(changed)
+}
+
+// GetMarksEvents returns tests published or rescored after since
+// (milliseconds since the epoch), including changes seen by this request's
+// scrape.
+func GetMarksEvents(token string, since int64) (*types.MarksEventsResponse, error) {
+	marks, err := GetMarks(token)
+	if err != nil {
+		return nil, err
+	}
+	if marks.RegNumber == "" {
+		return nil, errors.New("unable to resolve registration number")
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := db.GetMarkSnapshots(marks.RegNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	// The snapshot for this scrape may still be being written
+	if !marks.Stale {
+		snapshots = append(snapshots, helpers.ChangedMarkSnapshots(helpers.LatestMarkSnapshots(snapshots), marks, time.Now())...)
+	}
+
+	return &types.MarksEventsResponse{
+		RegNumber: marks.RegNumber,
+		Since:     since,
+		Events:    helpers.MarksEvents(snapshots, marks, since),
+		Stale:     marks.Stale,
+	}, nil
+}
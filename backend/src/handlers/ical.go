@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"goscraper/src/helpers"
+	"goscraper/src/helpers/databases"
+	"goscraper/src/types"
+	"strings"
+	"time"
+)
+
+const calendarFeedPath = "/api/calendar/feed/"
+
+var (
+	// ErrFeedNotFound is returned for unknown or revoked feed secrets.
+	ErrFeedNotFound = errors.New("calendar feed not found")
+	// ErrFeedTimetableMissing is returned when the timetable a feed is built
+	// from isn't cached, rather than serving a feed without classes.
+	ErrFeedTimetableMissing = errors.New("timetable for this feed is not cached; open the app to refresh it")
+)
+
+// GetICalendar builds an iCalendar file from the student's live timetable.
+func GetICalendar(token string) (string, error) {
+	entries, err := GetCalendarEntries(token)
+	if err != nil {
+		return "", err
+	}
+
+	timetable, err := GetTimetable(token)
+	if err != nil {
+		return "", err
+	}
+
+	return helpers.BuildICalendar("Vertex Timetable", entries, timetable, time.Now()), nil
+}
+
+// CreateCalendarFeed issues a new secret feed URL for the student. Any previous
+// feed URL stops working.
+func CreateCalendarFeed(token string, baseURL string) (*types.CalendarFeedResponse, error) {
+	// Fetching the timetable also refreshes the cached copy the feed is built from
+	timetable, err := GetTimetable(token)
+	if err != nil {
+		return nil, err
+	}
+	if timetable.RegNumber == "" {
+		return nil, errors.New("unable to resolve registration number")
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	secretStr := base64.RawURLEncoding.EncodeToString(secret)
+
+	feed, err := db.SetFeed(timetable.RegNumber, hashFeedSecret(secretStr))
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimSuffix(baseURL, "/") + calendarFeedPath + secretStr + ".ics"
+	webcal := url
+	if i := strings.Index(webcal, "://"); i != -1 {
+		webcal = "webcal" + webcal[i:]
+	}
+
+	return &types.CalendarFeedResponse{
+		URL:       url,
+		WebcalURL: webcal,
+		CreatedAt: feed.CreatedAt,
+	}, nil
+}
+
+// RevokeCalendarFeed disables the student's feed URL.
+func RevokeCalendarFeed(token string) error {
+	user, err := GetUser(token)
+	if err != nil {
+		return err
+	}
+	if user.RegNumber == "" {
+		return errors.New("unable to resolve registration number")
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return err
+	}
+	return db.DeleteFeed(user.RegNumber)
+}
+
+// GetCalendarFeed builds the iCalendar file for a feed secret from the cached
+// timetable and stored planner, so it always reflects their latest versions.
+// The cached timetable is kept while the feed exists.
+func GetCalendarFeed(secret string) (string, error) {
+	secret = strings.TrimSuffix(secret, ".ics")
+	if secret == "" {
+		return "", ErrFeedNotFound
+	}
+
+	db, err := databases.NewStore()
+	if err != nil {
+		return "", err
+	}
+
+	feed, err := db.FindFeed(hashFeedSecret(secret))
+	if err != nil {
+		return "", err
+	}
+	if feed == nil {
+		return "", ErrFeedNotFound
+	}
+
+	var timetable *types.TimetableResult
+	cached, err := db.FindByRegNumber(feed.RegNumber)
+	if err != nil {
+		return "", err
+	}
+	if cached != nil && cached["timetable"] != nil {
+		jsonBytes, err := json.Marshal(cached["timetable"])
+		if err == nil {
+			var result types.TimetableResult
+			if json.Unmarshal(jsonBytes, &result) == nil {
+				helpers.NormalizeTimetable(&result)
+				timetable = &result
+			}
+		}
+	}
+	if timetable == nil {
+		return "", ErrFeedTimetableMissing
+	}
+
+	entries, err := GetCalendarEntries("")
+	if err != nil {
+		return "", err
+	}
+
+	return helpers.BuildICalendar("Vertex Timetable", entries, timetable, time.Now()), nil
+}
+
+func hashFeedSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
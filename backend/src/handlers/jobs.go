@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"goscraper/src/helpers"
+	"goscraper/src/helpers/databases"
+	"goscraper/src/jobs"
+	"log"
+	"os"
+	"time"
+)
+
+// Names of the periodic jobs, as shown by the admin jobs endpoint.
+const (
+	JobCalendarRefresh    = "calendar-refresh"
+	JobCohortRefresh      = "cohort-refresh"
+	JobCachePruning       = "cache-pruning"
+	JobSessionReaping     = "session-reaping"
+	JobSnapshotCompaction = "snapshot-compaction"
+	JobReencryption       = "reencryption"
+	JobRetention          = "retention"
+)
+
+const (
+	defaultCacheMaxAge         = 12 * time.Hour
+	defaultSessionMaxAge       = 30 * 24 * time.Hour
+	defaultHistoryCompactAfter = 30 * 24 * time.Hour
+	defaultMaintenanceInterval = time.Hour
+)
+
+// durationFromEnv reads a positive duration such as "12h" from an environment
+// variable, falling back when it is unset or invalid.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	if raw := os.Getenv(name); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+// CacheMaxAge is how long cached sections are kept after a student's last
+// refresh, from CACHE_MAX_AGE.
+func CacheMaxAge() time.Duration {
+	return durationFromEnv("CACHE_MAX_AGE", defaultCacheMaxAge)
+}
+
+// SessionMaxAge is how long a session lasts, from SESSION_MAX_AGE.
+func SessionMaxAge() time.Duration {
+	return durationFromEnv("SESSION_MAX_AGE", defaultSessionMaxAge)
+}
+
+// HistoryCompactAfter is the age after which attendance and marks history is
+// kept at one snapshot per day, from HISTORY_COMPACT_AFTER.
+func HistoryCompactAfter() time.Duration {
+	return durationFromEnv("HISTORY_COMPACT_AFTER", defaultHistoryCompactAfter)
+}
+
+// MaintenanceInterval is how often the cache is pruned, sessions reaped and
+// history compacted, from MAINTENANCE_INTERVAL.
+func MaintenanceInterval() time.Duration {
+	return durationFromEnv("MAINTENANCE_INTERVAL", defaultMaintenanceInterval)
+}
+
+func millisAgo(d time.Duration) int64 {
+	return time.Now().Add(-d).UnixNano() / int64(time.Millisecond)
+}
+
+// PruneCache clears the cached sections of students who haven't refreshed
+// them within CacheMaxAge, returning how many students were pruned.
+func PruneCache() (int, error) {
+	db, err := databases.NewStore()
+	if err != nil {
+		return 0, err
+	}
+	return db.PruneSections(millisAgo(CacheMaxAge()))
+}
+
+// ReapSessions removes sessions older than SessionMaxAge, returning how many
+// were removed.
+func ReapSessions() (int, error) {
+	db, err := databases.NewStore()
+	if err != nil {
+		return 0, err
+	}
+	return db.DeleteSessionsBefore(millisAgo(SessionMaxAge()))
+}
+
+// CompactSnapshots thins every student's history older than
+// HistoryCompactAfter to the last snapshot of each course and test per day,
+// returning how many snapshots were removed.
+func CompactSnapshots(ctx context.Context) (int, error) {
+	db, err := databases.NewStore()
+	if err != nil {
+		return 0, err
+	}
+	regNumbers, err := db.StudentRegNumbers()
+	if err != nil {
+		return 0, err
+	}
+
+	before := millisAgo(HistoryCompactAfter())
+	removed := 0
+	for _, regNumber := range regNumbers {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+
+		attendance, err := db.GetAttendanceSnapshots(regNumber)
+		if err != nil {
+			return removed, err
+		}
+		if ids := helpers.RedundantAttendanceSnapshots(attendance, before); len(ids) > 0 {
+			if err := db.DeleteAttendanceSnapshotsByID(ids); err != nil {
+				return removed, err
+			}
+			removed += len(ids)
+		}
+
+		marks, err := db.GetMarkSnapshots(regNumber)
+		if err != nil {
+			return removed, err
+		}
+		if ids := helpers.RedundantMarkSnapshots(marks, before); len(ids) > 0 {
+			if err := db.DeleteMarkSnapshotsByID(ids); err != nil {
+				return removed, err
+			}
+			removed += len(ids)
+		}
+	}
+	return removed, nil
+}
+
+// StartJobs registers the periodic jobs with the scheduler. Cohort
+// statistics and re-encryption run straight away; the rest wait for their
+// first interval.
+func StartJobs() {
+	scheduler := jobs.Default()
+
+	scheduler.Every(JobCohortRefresh, CohortRefreshInterval, true, func(context.Context) error {
+		return RefreshCohortStats()
+	})
+
+	scheduler.Every(JobReencryption, ReencryptInterval, true, func(context.Context) error {
+		result, err := ReencryptCache()
+		if err != nil {
+			return err
+		}
+		if result.Updated > 0 || result.Failed > 0 {
+			log.Printf("Re-encrypted %d of %d cached, history and grade rows (%d unreadable)", result.Updated, result.Rows, result.Failed)
+		}
+		return nil
+	})
+
+	scheduler.Every(JobCalendarRefresh, CalendarRefreshInterval, false, func(context.Context) error {
+		changes, err := RefreshCalendar()
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			log.Printf("Calendar refresh recorded %d changed days", len(changes))
+		}
+		return nil
+	})
+
+	scheduler.Every(JobCachePruning, MaintenanceInterval, false, func(context.Context) error {
+		pruned, err := PruneCache()
+		if pruned > 0 {
+			log.Printf("Pruned cached sections of %d students", pruned)
+		}
+		return err
+	})
+
+	scheduler.Every(JobSessionReaping, MaintenanceInterval, false, func(context.Context) error {
+		reaped, err := ReapSessions()
+		if reaped > 0 {
+			log.Printf("Reaped %d expired sessions", reaped)
+		}
+		return err
+	})
+
+	scheduler.Every(JobSnapshotCompaction, MaintenanceInterval, false, func(ctx context.Context) error {
+		removed, err := CompactSnapshots(ctx)
+		if removed > 0 {
+			log.Printf("Compacted %d history snapshots", removed)
+		}
+		return err
+	})
+
+	if RetentionDays() > 0 {
+		scheduler.Every(JobRetention, func() time.Duration { return retentionCheckInterval }, true, func(context.Context) error {
+			purged, err := PurgeInactiveStudents()
+			if purged > 0 {
+				log.Printf("Retention policy deleted %d inactive students", purged)
+			}
+			return err
+		})
+	}
+}
+
+// runJob queues a periodic job outside its schedule, logging when it can't.
+func runJob(name string) {
+	if !jobs.Default().RunNow(name) {
+		log.Printf("Unable to queue job %s", name)
+	}
+}
+
+// submitJob queues a one-off job for work a request leaves behind, such as
+// writing the cache, so it is retried on failure and drained on shutdown.
+func submitJob(name string, run func() error) {
+	jobs.Submit(name, func(context.Context) error {
+		return run()
+	})
+}
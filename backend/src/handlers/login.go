@@ -1,11 +1,9 @@
 package handlers
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"goscraper/src/globals"
+	"goscraper/src/helpers/databases"
 	neturl "net/url"
 	"sort"
 	"strings"
@@ -137,6 +135,19 @@ type CaptchaData struct {
 	Cdigest string `json:"cdigest"` // captcha digest
 }
 
+// EndSession drops a session's cached responses and removes it from the
+// store, so the token stops working here even if the portal logout fails.
+func EndSession(token string) error {
+	db, err := databases.NewStore()
+	if err != nil {
+		return err
+	}
+	forgetPlannerToken(token)
+	hash := databases.SessionHash(token)
+	db.InvalidateSession(hash)
+	return db.DeleteSession(hash)
+}
+
 func (lf *LoginFetcher) Logout(token string) (map[string]interface{}, error) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
@@ -575,9 +586,24 @@ func (lf *LoginFetcher) GetSession(password string, lookup map[string]interface{
 	data["cookies"] = cookies
 
 	// Store session in active sessions
-	hash := sha256.Sum256([]byte(cookies))
-	hashStr := hex.EncodeToString(hash[:])
-	globals.ActiveSessions.Store(hashStr, true)
+	db, err := databases.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	sessionHash := databases.SessionHash(cookies)
+	if err := db.AddSession(sessionHash); err != nil {
+		return nil, err
+	}
+
+	// Link the session to the student right away, so deleting the account
+	// revokes it even if it never writes a section
+	submitJob("session-link", func() error {
+		user, err := GetUser(cookies)
+		if err != nil {
+			return err
+		}
+		return db.LinkSession(sessionHash, user.RegNumber)
+	})
 
 	return data, nil
 }
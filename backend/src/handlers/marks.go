@@ -5,25 +5,42 @@ import (
 	"goscraper/src/helpers"
 	"goscraper/src/helpers/databases"
 	"goscraper/src/types"
-	"goscraper/src/utils"
 )
 
 func GetMarks(token string) (*types.MarksResponse, error) {
-	encodedToken := utils.Encode(token)
-	db, _ := databases.NewDatabaseHelper()
-	// Always fetch fresh data
+	return getMarks(token, true)
+}
+
+// ScrapeMarks scrapes the marks even when the stored copy is still fresh.
+func ScrapeMarks(token string) (*types.MarksResponse, error) {
+	return getMarks(token, false)
+}
+
+func getMarks(token string, useStore bool) (*types.MarksResponse, error) {
+	sessionHash := databases.SessionHash(token)
+	db, _ := databases.NewStore()
+	if db != nil && useStore {
+		var cached types.MarksResponse
+		if freshness, ok := freshSection(db, sessionHash, helpers.SectionMarks, &cached); ok {
+			cached.Freshness = freshness
+			return &cached, nil
+		}
+	}
+
+	// Nothing fresh in the store - scrape
 	scraper := helpers.NewAcademicsFetch(token)
 	marks, err := scraper.GetMarks()
 	if err != nil {
 		// Scrape failed - check if we have any stale data as fallback
 		if db != nil {
-			cachedData, exists, _, _ := db.GetCachedDataByKey(encodedToken, "marks")
-			if exists {
+			cachedData, freshness, _ := db.GetCachedSection(sessionHash, helpers.SectionMarks)
+			if cachedData != nil {
 				var marksResponse types.MarksResponse
 				if jsonData, ok := cachedData.(map[string]interface{}); ok {
 					jsonBytes, _ := json.Marshal(jsonData)
 					json.Unmarshal(jsonBytes, &marksResponse)
 					marksResponse.Stale = true
+					marksResponse.Freshness = freshness
 					return &marksResponse, nil
 				}
 			}
@@ -31,14 +48,32 @@ func GetMarks(token string) (*types.MarksResponse, error) {
 		return nil, err
 	}
 
+	marks.Stale = false
+	marks.Freshness = helpers.FreshSection(helpers.SectionMarks)
+
 	// Scrape succeeded - update cache
 	if db != nil && marks != nil {
 		regNumber := ""
 		if marks.RegNumber != "" {
 			regNumber = marks.RegNumber
 		}
-		go db.UpsertDataByKey(encodedToken, regNumber, "marks", marks)
+		fetchedAt := marks.Freshness.FetchedAt
+		submitJob("cache-write", func() error {
+			return db.UpsertDataByKey(sessionHash, regNumber, helpers.SectionMarks, marks, fetchedAt)
+		})
+		submitJob("marks-history", func() error {
+			return recordMarksSnapshot(db, marks)
+		})
 	}
-	marks.Stale = false
 	return marks, nil
 }
+
+// GetMarksTargets returns each course's internal total and the end-semester
+// score needed for each grade.
+func GetMarksTargets(token string) (*types.MarksTargetsResponse, error) {
+	marks, err := GetMarks(token)
+	if err != nil {
+		return nil, err
+	}
+	return helpers.MarksTargets(marks), nil
+}
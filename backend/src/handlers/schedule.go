@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"goscraper/src/helpers"
+	"goscraper/src/types"
+	"time"
+)
+
+// GetToday returns today's classes along with the current and next class.
+func GetToday(token string) (*types.ScheduleResponse, error) {
+	return GetSchedule(token, time.Now().In(helpers.PlannerLocation), "")
+}
+
+// GetSchedule resolves the day order for a date from the planner and returns
+// the classes the timetable holds for it. Holidays and days without a day
+// order are reported through Status with no classes.
+func GetSchedule(token string, date time.Time, timing string) (*types.ScheduleResponse, error) {
+	entries, err := GetCalendarEntries(token)
+	if err != nil {
+		return nil, err
+	}
+
+	dateStr := date.Format("2006-01-02")
+	response := &types.ScheduleResponse{
+		Date:       dateStr,
+		Day:        date.Format("Mon"),
+		DayOrder:   "-",
+		Status:     types.ScheduleStatusNotInPlanner,
+		Categories: []string{},
+		Classes:    []types.ScheduledClass{},
+	}
+
+	var entry *types.CalendarEntry
+	for i := range entries {
+		if entries[i].Date == dateStr {
+			entry = &entries[i]
+			break
+		}
+	}
+	if entry == nil {
+		return response, nil
+	}
+
+	response.Day = entry.Day
+	response.DayOrder = entry.DayOrder
+	response.Event = entry.Event
+	response.Categories = entry.Categories
+
+	dayOrder, ok := helpers.ParseDayOrder(entry.DayOrder)
+	if !ok {
+		response.Status = types.ScheduleStatusNoDayOrder
+		if helpers.HasCategory(entry.Categories, types.DayCategoryHoliday) {
+			response.Status = types.ScheduleStatusHoliday
+		}
+		return response, nil
+	}
+
+	if timing == "" {
+		timing = helpers.TimingForDate(date)
+	}
+	timetable, err := GetTimetableWithTiming(token, timing)
+	if err != nil {
+		return nil, err
+	}
+
+	response.Status = types.ScheduleStatusClasses
+	response.Timing = timetable.Timing
+	response.Stale = timetable.Stale
+	response.Classes = helpers.ClassesForDayOrder(timetable, dayOrder)
+
+	now := time.Now().In(helpers.PlannerLocation)
+	if now.Format("2006-01-02") == dateStr {
+		response.Current, response.Next = helpers.CurrentAndNext(response.Classes, now)
+	}
+
+	return response, nil
+}
@@ -5,47 +5,59 @@ import (
 	"goscraper/src/helpers"
 	"goscraper/src/helpers/databases"
 	"goscraper/src/types"
-	"goscraper/src/utils"
-	"strconv"
 )
 
 func GetTimetable(token string) (*types.TimetableResult, error) {
-	encodedToken := utils.Encode(token)
-	db, _ := databases.NewDatabaseHelper()
-	// Always fetch fresh data
-	scraper := helpers.NewTimetable(token)
-	user, err := GetUser(token)
-	if err != nil {
-		// Scrape failed - check if we have any stale data as fallback
-		if db != nil {
-			cachedData, exists, _, _ := db.GetCachedDataByKey(encodedToken, "timetable")
-			if exists {
-				var timetableResult types.TimetableResult
-				if jsonData, ok := cachedData.(map[string]interface{}); ok {
-					jsonBytes, _ := json.Marshal(jsonData)
-					json.Unmarshal(jsonBytes, &timetableResult)
-					timetableResult.Stale = true
-					return &timetableResult, nil
-				}
-			}
-		}
-		return &types.TimetableResult{}, err
+	return GetTimetableWithTiming(token, "")
+}
+
+// GetTimetableWithTiming maps the timetable using a named timing profile, such
+// as "saturday" or "exam-week", instead of the grid's default.
+func GetTimetableWithTiming(token string, timing string) (*types.TimetableResult, error) {
+	return getTimetable(token, timing, true)
+}
+
+// ScrapeTimetable scrapes the timetable even when the stored copy is still
+// fresh.
+func ScrapeTimetable(token string) (*types.TimetableResult, error) {
+	return getTimetable(token, "", false)
+}
+
+func getTimetable(token string, timing string, useStore bool) (*types.TimetableResult, error) {
+	sessionHash := databases.SessionHash(token)
+	db, _ := databases.NewStore()
+	// Only the default timing is stored, so other profiles neither fall back
+	// to it nor overwrite it
+	if timing != "" {
+		db = nil
 	}
 
-	if user.Batch == "" {
-		user.Batch = "1"
+	if db != nil && useStore {
+		var cached types.TimetableResult
+		// A timetable mapped with a since-reloaded grid is re-scraped
+		freshness, ok := freshSection(db, sessionHash, helpers.SectionTimetable, &cached)
+		if ok && cached.GridVersion == helpers.SlotGridVersion() {
+			helpers.NormalizeTimetable(&cached)
+			cached.Freshness = freshness
+			return &cached, nil
+		}
 	}
-	batchNum, err := strconv.Atoi(user.Batch)
+
+	// Nothing fresh in the store - scrape
+	scraper := helpers.NewTimetable(token)
+	user, err := GetUser(token)
 	if err != nil {
 		// Scrape failed - check if we have any stale data as fallback
 		if db != nil {
-			cachedData, exists, _, _ := db.GetCachedDataByKey(encodedToken, "timetable")
-			if exists {
+			cachedData, freshness, _ := db.GetCachedSection(sessionHash, helpers.SectionTimetable)
+			if cachedData != nil {
 				var timetableResult types.TimetableResult
 				if jsonData, ok := cachedData.(map[string]interface{}); ok {
 					jsonBytes, _ := json.Marshal(jsonData)
 					json.Unmarshal(jsonBytes, &timetableResult)
+					helpers.NormalizeTimetable(&timetableResult)
 					timetableResult.Stale = true
+					timetableResult.Freshness = freshness
 					return &timetableResult, nil
 				}
 			}
@@ -53,17 +65,19 @@ func GetTimetable(token string) (*types.TimetableResult, error) {
 		return &types.TimetableResult{}, err
 	}
 
-	timetable, err := scraper.GetTimetable(batchNum)
+	timetable, err := scraper.GetTimetable(user.Program, helpers.StudentCampus(user), user.Batch, timing)
 	if err != nil {
 		// Scrape failed - check if we have any stale data as fallback
 		if db != nil {
-			cachedData, exists, _, _ := db.GetCachedDataByKey(encodedToken, "timetable")
-			if exists {
+			cachedData, freshness, _ := db.GetCachedSection(sessionHash, helpers.SectionTimetable)
+			if cachedData != nil {
 				var timetableResult types.TimetableResult
 				if jsonData, ok := cachedData.(map[string]interface{}); ok {
 					jsonBytes, _ := json.Marshal(jsonData)
 					json.Unmarshal(jsonBytes, &timetableResult)
+					helpers.NormalizeTimetable(&timetableResult)
 					timetableResult.Stale = true
+					timetableResult.Freshness = freshness
 					return &timetableResult, nil
 				}
 			}
@@ -71,14 +85,39 @@ func GetTimetable(token string) (*types.TimetableResult, error) {
 		return nil, err
 	}
 
+	timetable.Stale = false
+	timetable.Freshness = helpers.FreshSection(helpers.SectionTimetable)
+
 	// Scrape succeeded - update cache
 	if db != nil && timetable != nil {
 		regNumber := ""
 		if timetable.RegNumber != "" {
 			regNumber = timetable.RegNumber
 		}
-		go db.UpsertDataByKey(encodedToken, regNumber, "timetable", timetable)
+		fetchedAt := timetable.Freshness.FetchedAt
+		submitJob("cache-write", func() error {
+			return db.UpsertDataByKey(sessionHash, regNumber, helpers.SectionTimetable, timetable, fetchedAt)
+		})
 	}
-	timetable.Stale = false
 	return timetable, nil
 }
+
+// GetTimetableConflicts reports registered courses that clash in a slot.
+func GetTimetableConflicts(token string) (*types.TimetableConflictsResponse, error) {
+	timetable, err := GetTimetable(token)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := timetable.Conflicts
+	if conflicts == nil {
+		conflicts = []types.SlotConflict{}
+	}
+
+	return &types.TimetableConflictsResponse{
+		RegNumber:    timetable.RegNumber,
+		HasConflicts: len(conflicts) > 0,
+		Conflicts:    conflicts,
+		Stale:        timetable.Stale,
+	}, nil
+}
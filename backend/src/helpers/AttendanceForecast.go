@@ -0,0 +1,281 @@
+package helpers
+
+import (
+	"goscraper/src/types"
+	"math"
+	"strings"
+	"time"
+)
+
+// OnDutyAll marks every period of a leave as on duty.
+const OnDutyAll = "all"
+
+// CourseHours counts class hours by course code and course type.
+type CourseHours map[string]map[string]int
+
+func (h CourseHours) add(code string, courseType string, hours int) {
+	code = courseCodeKey(code)
+	if h[code] == nil {
+		h[code] = make(map[string]int)
+	}
+	h[code][strings.ToLower(strings.TrimSpace(courseType))] += hours
+}
+
+// For returns the hours of a course of the given category. Attendance lists
+// theory and practical components of a course separately, but when the course
+// has a single attendance row every hour of the course counts towards it.
+func (h CourseHours) For(code string, category string, onlyComponent bool) int {
+	byType := h[courseCodeKey(code)]
+	if hours, ok := byType[strings.ToLower(strings.TrimSpace(category))]; ok || !onlyComponent {
+		return hours
+	}
+	total := 0
+	for _, hours := range byType {
+		total += hours
+	}
+	return total
+}
+
+// ClassHours counts the hours each course meets on the planner's working days
+// from one ISO date to another, both inclusive, and returns the dates counted.
+func ClassHours(timetable *types.TimetableResult, entries []types.CalendarEntry, from string, to string) (CourseHours, []string) {
+	hours := make(CourseHours)
+	dates := []string{}
+	if timetable == nil {
+		return hours, dates
+	}
+
+	for _, entry := range entries {
+		if entry.Date < from || entry.Date > to {
+			continue
+		}
+		dayOrder, ok := ParseDayOrder(entry.DayOrder)
+		if !ok {
+			continue
+		}
+		dates = append(dates, entry.Date)
+		for _, course := range DayOrderHours(timetable, dayOrder) {
+			hours.add(course.Code, course.CourseType, course.Span)
+		}
+	}
+	return hours, dates
+}
+
+// DayOrderHours lists the courses met on a day order with the number of
+// periods each cell covers. Every course offered in an elective or clashing
+// cell is listed, since the timetable can't tell which one the student sits.
+func DayOrderHours(timetable *types.TimetableResult, dayOrder int) []types.ScheduledClass {
+	var classes []types.ScheduledClass
+	for _, day := range timetable.Schedule {
+		if day.Day != dayOrder {
+			continue
+		}
+		for _, cell := range day.Table {
+			if cell.Kind == types.CellKindFree || cell.Code == "" {
+				continue
+			}
+			span := max(cell.Span, 1)
+			courses := cell.Options
+			if len(courses) == 0 {
+				courses = []types.TableSlot{cell.TableSlot}
+			}
+			for _, course := range courses {
+				classes = append(classes, types.ScheduledClass{
+					Code:       course.Code,
+					Name:       course.Name,
+					Slot:       cell.Slot,
+					CourseType: course.CourseType,
+					Period:     cell.Period,
+					Span:       span,
+				})
+			}
+		}
+	}
+	return classes
+}
+
+// SemesterEnd returns the date of the planner's last working day, or the last
+// day with a day order when the planner doesn't mark one.
+func SemesterEnd(entries []types.CalendarEntry) string {
+	end := ""
+	for _, entry := range entries {
+		if HasCategory(entry.Categories, types.DayCategoryLastWorkingDay) {
+			return entry.Date
+		}
+		if _, ok := ParseDayOrder(entry.DayOrder); ok {
+			end = entry.Date
+		}
+	}
+	return end
+}
+
+// ForecastAttendance projects each course's attendance at the end of the
+// semester from the hours still to be held between from and until. Scenarios
+// cover attending everything, carrying on at the current rate and skipping
+// skip hours.
+func ForecastAttendance(attendance *types.AttendanceResponse, timetable *types.TimetableResult, entries []types.CalendarEntry, from string, until string, skip int) *types.AttendanceForecastResponse {
+	hours, dates := ClassHours(timetable, entries, from, until)
+	forecast := &types.AttendanceForecastResponse{
+		RegNumber:     attendance.RegNumber,
+		From:          from,
+		Until:         until,
+		RemainingDays: len(dates),
+		Skip:          skip,
+		Courses:       []types.CourseForecast{},
+		Unreachable:   []string{},
+		Stale:         attendance.Stale || (timetable != nil && timetable.Stale),
+	}
+
+	rows := attendanceRowsByCode(attendance)
+	for _, course := range attendance.Attendance {
+		attended, conducted := AttendedHours(course)
+		threshold := AttendanceThreshold(course.Category)
+		remaining := hours.For(course.CourseCode, course.Category, rows[courseCodeKey(course.CourseCode)] == 1)
+
+		rate := 1.0
+		if conducted > 0 {
+			rate = float64(attended) / float64(conducted)
+		}
+		skipped := min(skip, remaining)
+
+		total := conducted + remaining
+		best := attended + remaining
+		result := types.CourseForecast{
+			CourseCode:     course.CourseCode,
+			CourseTitle:    course.CourseTitle,
+			Category:       course.Category,
+			Threshold:      threshold,
+			Attended:       attended,
+			Conducted:      conducted,
+			RemainingHours: remaining,
+			MaxSkippable:   int(math.Floor(float64(best) - threshold/100*float64(total) + 1e-9)),
+			Scenarios: []types.AttendanceScenario{
+				projectScenario(types.ScenarioAttendAll, 0, best, total, threshold),
+				projectScenario(types.ScenarioCurrentRate, remaining-int(math.Round(rate*float64(remaining))), attended+int(math.Round(rate*float64(remaining))), total, threshold),
+				projectScenario(types.ScenarioSkip, skipped, best-skipped, total, threshold),
+			},
+		}
+		result.MaxSkippable = min(result.MaxSkippable, remaining)
+		result.CanReachThreshold = result.Scenarios[0].MeetsThreshold
+		if !result.CanReachThreshold {
+			result.MaxSkippable = 0
+			forecast.Unreachable = append(forecast.Unreachable, course.CourseCode)
+		}
+		forecast.Courses = append(forecast.Courses, result)
+	}
+	return forecast
+}
+
+func projectScenario(name string, skipped int, attended int, conducted int, threshold float64) types.AttendanceScenario {
+	margin := AttendanceMarginFor(attended, conducted, threshold)
+	return types.AttendanceScenario{
+		Name:           name,
+		Skipped:        skipped,
+		Attended:       attended,
+		Conducted:      conducted,
+		Percentage:     margin.Percentage,
+		MeetsThreshold: margin.Safe,
+	}
+}
+
+func attendanceRowsByCode(attendance *types.AttendanceResponse) map[string]int {
+	rows := make(map[string]int)
+	for _, course := range attendance.Attendance {
+		rows[courseCodeKey(course.CourseCode)]++
+	}
+	return rows
+}
+
+func courseCodeKey(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// LeaveImpact projects attendance for a leave from one ISO date to another.
+// today is the first day whose classes aren't in the portal's counts yet.
+// Classes from today up to the leave and after it are assumed attended. Days
+// of the leave before today are already counted, so only the rest of the
+// leave, today included, is missed.
+// Periods of the courses in onDuty, or every period when it holds OnDutyAll,
+// count as attended rather than absent.
+func LeaveImpact(attendance *types.AttendanceResponse, timetable *types.TimetableResult, entries []types.CalendarEntry, today string, from string, to string, onDuty []string) *types.LeaveImpactResponse {
+	before, _ := ClassHours(timetable, entries, today, addDays(from, -1))
+	_, days := ClassHours(timetable, entries, from, to)
+	missed, _ := ClassHours(timetable, entries, maxDate(today, from), to)
+	after, _ := ClassHours(timetable, entries, maxDate(today, addDays(to, 1)), SemesterEnd(entries))
+
+	odCourses := make(map[string]bool)
+	for _, code := range onDuty {
+		odCourses[courseCodeKey(code)] = true
+	}
+
+	impact := &types.LeaveImpactResponse{
+		RegNumber:      attendance.RegNumber,
+		From:           from,
+		To:             to,
+		Days:           days,
+		OnDuty:         onDuty,
+		Courses:        []types.CourseLeaveImpact{},
+		BelowThreshold: []string{},
+		Stale:          attendance.Stale || (timetable != nil && timetable.Stale),
+	}
+	if impact.OnDuty == nil {
+		impact.OnDuty = []string{}
+	}
+
+	rows := attendanceRowsByCode(attendance)
+	for _, course := range attendance.Attendance {
+		onlyComponent := rows[courseCodeKey(course.CourseCode)] == 1
+		attended, conducted := AttendedHours(course)
+		threshold := AttendanceThreshold(course.Category)
+
+		result := types.CourseLeaveImpact{
+			CourseCode:  course.CourseCode,
+			CourseTitle: course.CourseTitle,
+			Category:    course.Category,
+			Threshold:   threshold,
+			MissedHours: missed.For(course.CourseCode, course.Category, onlyComponent),
+		}
+		if odCourses[OnDutyAll] || odCourses[courseCodeKey(course.CourseCode)] {
+			result.OnDutyHours = result.MissedHours
+			result.MissedHours = 0
+		}
+		result.CurrentPercentage = AttendanceMarginFor(attended, conducted, threshold).Percentage
+
+		attended += before.For(course.CourseCode, course.Category, onlyComponent)
+		conducted += before.For(course.CourseCode, course.Category, onlyComponent)
+		preLeave := AttendanceMarginFor(attended, conducted, threshold)
+
+		attended += result.OnDutyHours
+		conducted += result.OnDutyHours + result.MissedHours
+		projected := AttendanceMarginFor(attended, conducted, threshold)
+		result.ProjectedPercentage = projected.Percentage
+
+		remaining := after.For(course.CourseCode, course.Category, onlyComponent)
+		end := AttendanceMarginFor(attended+remaining, conducted+remaining, threshold)
+		result.EndOfSemesterPercentage = end.Percentage
+		result.CanRecover = end.Safe
+
+		// Only courses the leave itself pushes below their threshold
+		result.DropsBelowThreshold = preLeave.Safe && !projected.Safe
+		if result.DropsBelowThreshold {
+			impact.BelowThreshold = append(impact.BelowThreshold, course.CourseCode)
+		}
+		impact.Courses = append(impact.Courses, result)
+	}
+	return impact
+}
+
+func addDays(date string, days int) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t.AddDate(0, 0, days).Format("2006-01-02")
+}
+
+func maxDate(a string, b string) string {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,71 @@
+package helpers
+
+import (
+	"goscraper/src/types"
+	"testing"
+)
+
+// leaveFixture is one course meeting for two hours on day order 1 and one
+// hour on day order 2, over a planner of 20 to 24 October.
+func leaveFixture() (*types.AttendanceResponse, *types.TimetableResult, []types.CalendarEntry) {
+	attendance := &types.AttendanceResponse{
+		RegNumber: "RA2311003010001",
+		Attendance: []types.Attendance{{
+			CourseCode:     "21CS101T",
+			Category:       "Theory",
+			HoursConducted: "40",
+			HoursAbsent:    "8",
+		}},
+	}
+	course := types.TableSlot{Code: "21CS101T", CourseType: "Theory"}
+	timetable := &types.TimetableResult{
+		Schedule: []types.DaySchedule{
+			{Day: 1, Table: []types.TimetableCell{{TableSlot: course, Span: 2}}},
+			{Day: 2, Table: []types.TimetableCell{{TableSlot: course, Span: 1}}},
+		},
+	}
+	entries := []types.CalendarEntry{
+		{Date: "2025-10-20", DayOrder: "1"},
+		{Date: "2025-10-21", DayOrder: "2"},
+		{Date: "2025-10-22", DayOrder: "1"},
+		{Date: "2025-10-23", DayOrder: "-"},
+		{Date: "2025-10-24", DayOrder: "2"},
+	}
+	return attendance, timetable, entries
+}
+
+func TestLeaveImpactMissedWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		today      string
+		from       string
+		to         string
+		wantDays   int
+		wantMissed int
+		wantEnd    float64
+	}{
+		// Today's two hours aren't counted yet, so they are missed
+		{"same-day leave", "2025-10-20", "2025-10-20", "2025-10-20", 1, 2, 78.26},
+		// 20 and 21 October are already counted; only 22 October is missed
+		{"leave started in the past", "2025-10-22", "2025-10-20", "2025-10-22", 3, 2, 76.74},
+		{"leave in the future", "2025-10-20", "2025-10-21", "2025-10-22", 2, 3, 76.09},
+		{"leave already over", "2025-10-24", "2025-10-20", "2025-10-22", 3, 0, 80.49},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attendance, timetable, entries := leaveFixture()
+			impact := LeaveImpact(attendance, timetable, entries, tt.today, tt.from, tt.to, nil)
+			if len(impact.Days) != tt.wantDays {
+				t.Errorf("days %v, want %d", impact.Days, tt.wantDays)
+			}
+			course := impact.Courses[0]
+			if course.MissedHours != tt.wantMissed {
+				t.Errorf("missed %d hours, want %d", course.MissedHours, tt.wantMissed)
+			}
+			if course.EndOfSemesterPercentage != tt.wantEnd {
+				t.Errorf("end of semester %v%%, want %v%%", course.EndOfSemesterPercentage, tt.wantEnd)
+			}
+		})
+	}
+}
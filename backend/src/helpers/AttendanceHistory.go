@@ -0,0 +1,158 @@
+package helpers
+
+import (
+	"fmt"
+	"goscraper/src/types"
+	"sort"
+	"strings"
+	"time"
+)
+
+func snapshotKey(code string, category string) string {
+	return courseCodeKey(code) + "|" + strings.ToLower(strings.TrimSpace(category))
+}
+
+// LatestAttendanceSnapshots returns the most recent snapshot of each course.
+func LatestAttendanceSnapshots(snapshots []types.AttendanceSnapshot) map[string]types.AttendanceSnapshot {
+	latest := make(map[string]types.AttendanceSnapshot)
+	for _, snapshot := range snapshots {
+		key := snapshotKey(snapshot.CourseCode, snapshot.Category)
+		if previous, ok := latest[key]; !ok || snapshot.ScrapedAt >= previous.ScrapedAt {
+			latest[key] = snapshot
+		}
+	}
+	return latest
+}
+
+// ChangedAttendanceSnapshots turns a scrape into snapshots, keeping only the
+// courses whose counts differ from their latest stored snapshot.
+func ChangedAttendanceSnapshots(latest map[string]types.AttendanceSnapshot, attendance *types.AttendanceResponse, scrapedAt time.Time) []types.AttendanceSnapshot {
+	var changed []types.AttendanceSnapshot
+	if attendance == nil || attendance.RegNumber == "" {
+		return changed
+	}
+
+	for _, course := range attendance.Attendance {
+		attended, conducted := AttendedHours(course)
+		snapshot := types.AttendanceSnapshot{
+			RegNumber:  attendance.RegNumber,
+			CourseCode: strings.TrimSpace(course.CourseCode),
+			Category:   strings.TrimSpace(course.Category),
+			Conducted:  conducted,
+			Absent:     conducted - attended,
+			ScrapedAt:  scrapedAt.UnixNano() / int64(time.Millisecond),
+		}
+		previous, ok := latest[snapshotKey(snapshot.CourseCode, snapshot.Category)]
+		if ok && previous.Conducted == snapshot.Conducted && previous.Absent == snapshot.Absent {
+			continue
+		}
+		changed = append(changed, snapshot)
+	}
+	return changed
+}
+
+// AttendanceHistory groups snapshots into a series per course and diffs
+// consecutive snapshots into events, newest event first. Titles are taken
+// from the current attendance when given.
+func AttendanceHistory(snapshots []types.AttendanceSnapshot, attendance *types.AttendanceResponse) ([]types.AttendanceSeries, []types.AttendanceEvent) {
+	sorted := append([]types.AttendanceSnapshot(nil), snapshots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ScrapedAt < sorted[j].ScrapedAt
+	})
+
+	titles := make(map[string]string)
+	if attendance != nil {
+		for _, course := range attendance.Attendance {
+			titles[snapshotKey(course.CourseCode, course.Category)] = course.CourseTitle
+		}
+	}
+
+	var order []string
+	series := make(map[string]*types.AttendanceSeries)
+	previous := make(map[string]types.AttendanceSnapshot)
+	events := []types.AttendanceEvent{}
+
+	for _, snapshot := range sorted {
+		key := snapshotKey(snapshot.CourseCode, snapshot.Category)
+		s, ok := series[key]
+		if !ok {
+			s = &types.AttendanceSeries{
+				CourseCode:  snapshot.CourseCode,
+				CourseTitle: titles[key],
+				Category:    snapshot.Category,
+			}
+			series[key] = s
+			order = append(order, key)
+		}
+
+		margin := AttendanceMarginFor(snapshot.Conducted-snapshot.Absent, snapshot.Conducted, AttendanceThreshold(snapshot.Category))
+		s.Points = append(s.Points, types.AttendancePoint{
+			ScrapedAt:  snapshot.ScrapedAt,
+			Date:       snapshotDate(snapshot.ScrapedAt),
+			Conducted:  snapshot.Conducted,
+			Absent:     snapshot.Absent,
+			Percentage: margin.Percentage,
+		})
+
+		prev, seen := previous[key]
+		events = append(events, DiffAttendanceSnapshots(prev, snapshot, seen)...)
+		previous[key] = snapshot
+	}
+
+	courses := make([]types.AttendanceSeries, 0, len(order))
+	for _, key := range order {
+		courses = append(courses, *series[key])
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].ScrapedAt > events[j].ScrapedAt
+	})
+	return courses, events
+}
+
+// DiffAttendanceSnapshots describes what changed between two snapshots of a
+// course. When seen is false, next is the first snapshot of the course.
+func DiffAttendanceSnapshots(previous types.AttendanceSnapshot, next types.AttendanceSnapshot, seen bool) []types.AttendanceEvent {
+	event := func(kind string, delta int, message string) types.AttendanceEvent {
+		return types.AttendanceEvent{
+			Type:       kind,
+			CourseCode: next.CourseCode,
+			Category:   next.Category,
+			Delta:      delta,
+			Date:       snapshotDate(next.ScrapedAt),
+			ScrapedAt:  next.ScrapedAt,
+			Message:    message,
+		}
+	}
+
+	if !seen {
+		return []types.AttendanceEvent{event(types.AttendanceEventCourseAdded, next.Conducted,
+			fmt.Sprintf("Started tracking %s (%s)", next.CourseCode, next.Category))}
+	}
+
+	var events []types.AttendanceEvent
+	date := snapshotDate(next.ScrapedAt)
+	if delta := next.Conducted - previous.Conducted; delta != 0 {
+		events = append(events, event(types.AttendanceEventHoursConducted, delta,
+			fmt.Sprintf("Hours conducted %+d in %s", delta, next.CourseCode)))
+	}
+	if delta := next.Absent - previous.Absent; delta > 0 {
+		events = append(events, event(types.AttendanceEventAbsentMarked, delta,
+			fmt.Sprintf("Absent marked in %s on %s (%s)", next.CourseCode, date, pluralHours(delta))))
+	} else if delta < 0 {
+		events = append(events, event(types.AttendanceEventAbsentRemoved, delta,
+			fmt.Sprintf("Absence removed in %s on %s (%s)", next.CourseCode, date, pluralHours(-delta))))
+	}
+	return events
+}
+
+func snapshotDate(scrapedAt int64) string {
+	return time.UnixMilli(scrapedAt).In(PlannerLocation).Format("2006-01-02")
+}
+
+func pluralHours(n int) string {
+	if n == 1 {
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d hours", n)
+}
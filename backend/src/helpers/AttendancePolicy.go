@@ -0,0 +1,198 @@
+package helpers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"goscraper/src/types"
+	"goscraper/src/utils"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+//go:embed data/attendance_policy.json
+var defaultAttendancePolicy []byte
+
+// AttendancePolicy holds the minimum attendance percentage, with optional
+// overrides keyed by course category such as "Practical".
+type AttendancePolicy struct {
+	Version    int                `json:"version"`
+	Threshold  float64            `json:"threshold"`
+	Categories map[string]float64 `json:"categories"`
+}
+
+var (
+	attendancePolicyMu sync.RWMutex
+	attendancePolicy   *AttendancePolicy
+)
+
+// LoadAttendancePolicy reads the policy from ATTENDANCE_POLICY_PATH, falling
+// back to the policy bundled with the binary.
+func LoadAttendancePolicy() (*AttendancePolicy, error) {
+	raw := defaultAttendancePolicy
+	if path := os.Getenv("ATTENDANCE_POLICY_PATH"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attendance policy: %v", err)
+		}
+		raw = data
+	}
+
+	policy, err := parseAttendancePolicy(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	attendancePolicyMu.Lock()
+	attendancePolicy = policy
+	attendancePolicyMu.Unlock()
+	return policy, nil
+}
+
+func parseAttendancePolicy(raw []byte) (*AttendancePolicy, error) {
+	var policy AttendancePolicy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return nil, fmt.Errorf("invalid attendance policy: %v", err)
+	}
+
+	if !validThreshold(policy.Threshold) {
+		return nil, fmt.Errorf("attendance policy: threshold %v must be between 0 and 100", policy.Threshold)
+	}
+	categories := make(map[string]float64, len(policy.Categories))
+	for category, threshold := range policy.Categories {
+		if !validThreshold(threshold) {
+			return nil, fmt.Errorf("attendance policy: threshold %v for %q must be between 0 and 100", threshold, category)
+		}
+		categories[strings.ToLower(strings.TrimSpace(category))] = threshold
+	}
+	policy.Categories = categories
+	return &policy, nil
+}
+
+func validThreshold(threshold float64) bool {
+	return threshold > 0 && threshold < 100
+}
+
+func getAttendancePolicy() *AttendancePolicy {
+	attendancePolicyMu.RLock()
+	policy := attendancePolicy
+	attendancePolicyMu.RUnlock()
+	if policy != nil {
+		return policy
+	}
+
+	policy, err := LoadAttendancePolicy()
+	if err != nil {
+		log.Printf("Falling back to bundled attendance policy: %v", err)
+		policy, _ = parseAttendancePolicy(defaultAttendancePolicy)
+		attendancePolicyMu.Lock()
+		attendancePolicy = policy
+		attendancePolicyMu.Unlock()
+	}
+	return policy
+}
+
+// DefaultAttendanceThreshold is the threshold for courses without a category
+// override.
+func DefaultAttendanceThreshold() float64 {
+	return getAttendancePolicy().Threshold
+}
+
+// AttendanceThreshold returns the threshold that applies to a course category.
+func AttendanceThreshold(category string) float64 {
+	policy := getAttendancePolicy()
+	if threshold, ok := policy.Categories[strings.ToLower(strings.TrimSpace(category))]; ok {
+		return threshold
+	}
+	return policy.Threshold
+}
+
+// AttendanceMarginFor works out how many classes are needed to reach the
+// threshold, or how many can be skipped while staying at or above it.
+func AttendanceMarginFor(attended int, conducted int, threshold float64) types.AttendanceMargin {
+	margin := types.AttendanceMargin{
+		Threshold:  threshold,
+		Attended:   attended,
+		Conducted:  conducted,
+		Percentage: 100,
+	}
+	if conducted > 0 {
+		margin.Percentage = math.Round(float64(attended)/float64(conducted)*10000) / 100
+	}
+
+	// Small tolerance so that exact ratios such as 3/4 at 75% aren't lost to
+	// floating point error.
+	const epsilon = 1e-9
+	t := threshold / 100
+	a := float64(attended)
+	c := float64(conducted)
+
+	if a >= t*c-epsilon {
+		margin.Safe = true
+		margin.Skippable = int(math.Floor(a/t - c + epsilon))
+		if margin.Skippable < 0 {
+			margin.Skippable = 0
+		}
+		return margin
+	}
+
+	margin.Required = int(math.Ceil((t*c-a)/(1-t) - epsilon))
+	return margin
+}
+
+// AttendanceMargins attaches a margin to every course in the response.
+func AttendanceMargins(response *types.AttendanceResponse) {
+	if response == nil {
+		return
+	}
+	for i := range response.Attendance {
+		course := &response.Attendance[i]
+		attended, conducted := AttendedHours(*course)
+		margin := AttendanceMarginFor(attended, conducted, AttendanceThreshold(course.Category))
+		course.Margin = &margin
+	}
+}
+
+// AttendedHours parses the conducted and absent hours scraped for a course.
+func AttendedHours(course types.Attendance) (int, int) {
+	conducted := utils.ParseInt(strings.TrimSpace(course.HoursConducted))
+	absent := utils.ParseInt(strings.TrimSpace(course.HoursAbsent))
+	if absent > conducted {
+		absent = conducted
+	}
+	return conducted - absent, conducted
+}
+
+// AttendanceInsights lists the margin for every course, with the courses
+// below their threshold first.
+func AttendanceInsights(response *types.AttendanceResponse) *types.AttendanceInsightsResponse {
+	insights := &types.AttendanceInsightsResponse{
+		RegNumber: response.RegNumber,
+		Threshold: DefaultAttendanceThreshold(),
+		Courses:   []types.AttendanceInsight{},
+		Stale:     response.Stale,
+	}
+
+	var safe []types.AttendanceInsight
+	for _, course := range response.Attendance {
+		attended, conducted := AttendedHours(course)
+		insight := types.AttendanceInsight{
+			CourseCode:  course.CourseCode,
+			CourseTitle: course.CourseTitle,
+			Category:    course.Category,
+			Slot:        course.Slot,
+			Margin:      AttendanceMarginFor(attended, conducted, AttendanceThreshold(course.Category)),
+		}
+		if insight.Margin.Safe {
+			safe = append(safe, insight)
+			continue
+		}
+		insights.AtRisk++
+		insights.Courses = append(insights.Courses, insight)
+	}
+	insights.Courses = append(insights.Courses, safe...)
+	return insights
+}
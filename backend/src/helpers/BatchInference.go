@@ -0,0 +1,131 @@
+package helpers
+
+import (
+	"fmt"
+	"goscraper/src/types"
+	"math"
+	"sort"
+	"strings"
+)
+
+// minBatchConfidence is the lead the best grid needs over the runner-up before
+// the inferred batch is preferred over the profile batch.
+const minBatchConfidence = 0.5
+
+// InferBatch scores every grid by the share of the student's registered slot
+// codes it contains and picks the best fit. Only codes that some grids have
+// and others don't are scored, since codes every grid shares say nothing
+// about the batch. When no grid clearly wins, the
+// profile batch is used if it names a grid, otherwise the best scoring one.
+func InferBatch(courses []types.Course, grids []types.Batch, profileBatch string) types.BatchResolution {
+	profileBatch = strings.TrimSpace(profileBatch)
+	resolution := types.BatchResolution{
+		ProfileBatch: profileBatch,
+		Scores:       make(map[string]float64),
+	}
+	if len(grids) == 0 {
+		resolution.Batch = profileBatch
+		resolution.Source = types.BatchSourceProfile
+		resolution.Reason = "no slot grids configured"
+		return resolution
+	}
+
+	var codes []string
+	seen := make(map[string]bool)
+	for _, course := range courses {
+		for _, slot := range strings.Split(course.Slot, "-") {
+			slot = strings.TrimSpace(slot)
+			if slot == "" || seen[slot] {
+				continue
+			}
+			seen[slot] = true
+			codes = append(codes, slot)
+		}
+	}
+
+	present := make([]map[string]bool, len(grids))
+	gridsWith := make(map[string]int)
+	for i, grid := range grids {
+		present[i] = make(map[string]bool)
+		for _, day := range grid.Slots {
+			for _, slot := range day.Slots {
+				if !present[i][slot] {
+					present[i][slot] = true
+					gridsWith[slot]++
+				}
+			}
+		}
+	}
+
+	var telling []string
+	for _, code := range codes {
+		if gridsWith[code] > 0 && gridsWith[code] < len(grids) {
+			telling = append(telling, code)
+		}
+	}
+
+	type scored struct {
+		batch string
+		score float64
+	}
+	var ranked []scored
+	for i, grid := range grids {
+		matched := 0
+		for _, code := range telling {
+			if present[i][code] {
+				matched++
+			}
+		}
+
+		score := 0.0
+		if len(telling) > 0 {
+			score = math.Round(float64(matched)/float64(len(telling))*1000) / 1000
+		}
+		resolution.Scores[grid.Batch] = score
+		ranked = append(ranked, scored{grid.Batch, score})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+
+	best := ranked[0]
+	runnerUp := 0.0
+	if len(ranked) > 1 {
+		runnerUp = ranked[1].score
+	}
+	if best.score > 0 {
+		resolution.Confidence = math.Round((best.score-runnerUp)/best.score*1000) / 1000
+	}
+
+	if best.score > 0 && resolution.Confidence >= minBatchConfidence {
+		resolution.Batch = best.batch
+		resolution.Source = types.BatchSourceInferred
+		resolution.Reason = fmt.Sprintf("batch %s grid contains %.0f%% of the registered slots that tell the grids apart", best.batch, best.score*100)
+		if profileBatch != "" && profileBatch != best.batch {
+			resolution.Reason += fmt.Sprintf("; profile says batch %s", profileBatch)
+		}
+		return resolution
+	}
+
+	reason := "no grid clearly fits the registered slots"
+	if len(codes) == 0 {
+		reason = "no registered slots to compare"
+	} else if len(telling) == 0 {
+		reason = "the registered slots don't tell the grids apart"
+	} else if best.score == 0 {
+		reason = "no grid contains the registered slots"
+	}
+
+	if _, ok := resolution.Scores[profileBatch]; ok {
+		resolution.Batch = profileBatch
+		resolution.Source = types.BatchSourceProfile
+		resolution.Reason = reason + "; using the profile batch"
+		return resolution
+	}
+
+	resolution.Batch = best.batch
+	resolution.Source = types.BatchSourceDefault
+	resolution.Reason = reason + "; profile batch missing or unknown, using batch " + best.batch
+	return resolution
+}
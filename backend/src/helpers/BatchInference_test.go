@@ -0,0 +1,64 @@
+package helpers
+
+import (
+	"goscraper/src/types"
+	"testing"
+)
+
+func theoryCourses() []types.Course {
+	var courses []types.Course
+	for _, slot := range []string{"A", "B", "C", "D", "E", "F", "G"} {
+		courses = append(courses, types.Course{Code: "21CS" + slot, Slot: slot})
+	}
+	return courses
+}
+
+func TestInferBatch(t *testing.T) {
+	t.Setenv("SLOT_GRIDS_PATH", "")
+	if _, err := LoadSlotGrids(); err != nil {
+		t.Fatalf("load bundled grids: %v", err)
+	}
+	grids := SlotGridsFor("", "")
+	if len(grids) != 2 {
+		t.Fatalf("bundled grids: got %d batches, want 2", len(grids))
+	}
+
+	batch1 := append(theoryCourses(),
+		types.Course{Code: "21CS101L", Slot: "P1-P2-P3-P4-P5"},
+		types.Course{Code: "21CS102L", Slot: "P36-P37-P38-"},
+	)
+	batch2 := append(theoryCourses(),
+		types.Course{Code: "21CS101L", Slot: "P6-P7-P8-P9-P10"},
+		types.Course{Code: "21CS102L", Slot: "P31-P32-P33-"},
+	)
+
+	tests := []struct {
+		name           string
+		courses        []types.Course
+		profile        string
+		wantBatch      string
+		wantSource     string
+		wantConfidence float64
+	}{
+		{"batch 1 timetable", batch1, "", "1", types.BatchSourceInferred, 1},
+		{"batch 2 timetable", batch2, "", "2", types.BatchSourceInferred, 1},
+		{"batch 2 timetable overrides profile", batch2, "1", "2", types.BatchSourceInferred, 1},
+		{"theory only uses profile", theoryCourses(), "2", "2", types.BatchSourceProfile, 0},
+		{"labs in both grids use profile", append(theoryCourses(),
+			types.Course{Code: "21CS101L", Slot: "P1-P2"},
+			types.Course{Code: "21CS102L", Slot: "P6-P7"},
+		), "1", "1", types.BatchSourceProfile, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := InferBatch(tt.courses, grids, tt.profile)
+			if got.Batch != tt.wantBatch || got.Source != tt.wantSource {
+				t.Fatalf("got batch %s from %s, want %s from %s (%s)", got.Batch, got.Source, tt.wantBatch, tt.wantSource, got.Reason)
+			}
+			if got.Confidence != tt.wantConfidence {
+				t.Errorf("confidence %v, want %v", got.Confidence, tt.wantConfidence)
+			}
+		})
+	}
+}
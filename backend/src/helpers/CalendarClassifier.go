@@ -0,0 +1,332 @@
+package helpers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"goscraper/src/types"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed data/calendar_rules.json
+var defaultCalendarRules []byte
+
+// PlannerLocation is the timezone the academic planner is published in.
+var PlannerLocation = time.FixedZone("IST", 5*60*60+30*60)
+
+type CalendarRule struct {
+	Category string `json:"category"`
+	Event    string `json:"event,omitempty"`
+	DayOrder string `json:"dayOrder,omitempty"`
+	Day      string `json:"day,omitempty"`
+
+	event    *regexp.Regexp
+	dayOrder *regexp.Regexp
+	day      *regexp.Regexp
+}
+
+type calendarRuleSet struct {
+	Version int            `json:"version"`
+	Rules   []CalendarRule `json:"rules"`
+}
+
+var (
+	calendarRulesMu sync.RWMutex
+	calendarRules   []CalendarRule
+)
+
+// LoadCalendarRules reads the classification rules from CALENDAR_RULES_PATH,
+// falling back to the rules bundled with the binary.
+func LoadCalendarRules() error {
+	raw := defaultCalendarRules
+	if path := os.Getenv("CALENDAR_RULES_PATH"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read calendar rules: %v", err)
+		}
+		raw = data
+	}
+
+	rules, err := parseCalendarRules(raw)
+	if err != nil {
+		return err
+	}
+
+	calendarRulesMu.Lock()
+	calendarRules = rules
+	calendarRulesMu.Unlock()
+	return nil
+}
+
+func parseCalendarRules(raw []byte) ([]CalendarRule, error) {
+	var set calendarRuleSet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("invalid calendar rules: %v", err)
+	}
+
+	compile := func(pattern string) (*regexp.Regexp, error) {
+		if pattern == "" {
+			return nil, nil
+		}
+		return regexp.Compile(pattern)
+	}
+
+	for i := range set.Rules {
+		rule := &set.Rules[i]
+		if rule.Category == "" {
+			return nil, fmt.Errorf("calendar rule %d has no category", i)
+		}
+		var err error
+		if rule.event, err = compile(rule.Event); err != nil {
+			return nil, fmt.Errorf("calendar rule %d: %v", i, err)
+		}
+		if rule.dayOrder, err = compile(rule.DayOrder); err != nil {
+			return nil, fmt.Errorf("calendar rule %d: %v", i, err)
+		}
+		if rule.day, err = compile(rule.Day); err != nil {
+			return nil, fmt.Errorf("calendar rule %d: %v", i, err)
+		}
+	}
+	return set.Rules, nil
+}
+
+func getCalendarRules() []CalendarRule {
+	calendarRulesMu.RLock()
+	rules := calendarRules
+	calendarRulesMu.RUnlock()
+	if rules != nil {
+		return rules
+	}
+
+	if err := LoadCalendarRules(); err != nil {
+		log.Printf("Falling back to bundled calendar rules: %v", err)
+		rules, _ = parseCalendarRules(defaultCalendarRules)
+		calendarRulesMu.Lock()
+		calendarRules = rules
+		calendarRulesMu.Unlock()
+		return rules
+	}
+
+	calendarRulesMu.RLock()
+	defer calendarRulesMu.RUnlock()
+	return calendarRules
+}
+
+func (r *CalendarRule) matches(day types.Day) bool {
+	if r.event != nil && !r.event.MatchString(strings.TrimSpace(day.Event)) {
+		return false
+	}
+	if r.dayOrder != nil && !r.dayOrder.MatchString(strings.TrimSpace(day.DayOrder)) {
+		return false
+	}
+	if r.day != nil && !r.day.MatchString(strings.TrimSpace(day.Day)) {
+		return false
+	}
+	return true
+}
+
+// ClassifyDay returns every category whose rule matches the planner day.
+func ClassifyDay(day types.Day) []string {
+	categories := []string{}
+	seen := make(map[string]bool)
+	for _, rule := range getCalendarRules() {
+		if seen[rule.Category] || !rule.matches(day) {
+			continue
+		}
+		seen[rule.Category] = true
+		categories = append(categories, rule.Category)
+	}
+	return categories
+}
+
+// ClassifyCalendar tags every day in the calendar in place.
+func ClassifyCalendar(calendar *types.CalendarResponse) {
+	if calendar == nil {
+		return
+	}
+	for i := range calendar.Calendar {
+		for j := range calendar.Calendar[i].Days {
+			day := &calendar.Calendar[i].Days[j]
+			day.Categories = ClassifyDay(*day)
+		}
+	}
+	if calendar.Today != nil {
+		calendar.Today.Categories = ClassifyDay(*calendar.Today)
+	}
+	if calendar.Tomorrow != nil {
+		calendar.Tomorrow.Categories = ClassifyDay(*calendar.Tomorrow)
+	}
+}
+
+func HasCategory(categories []string, category string) bool {
+	for _, c := range categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// PlannerDate resolves a planner month header such as "Jul '25" and a day of
+// the month into a date. The year comes from the header when it has one,
+// otherwise from year.
+func PlannerDate(month string, year int, date string) (time.Time, bool) {
+	monthOfYear, headerYear, ok := plannerMonth(month)
+	if !ok {
+		return time.Time{}, false
+	}
+	if headerYear != 0 {
+		year = headerYear
+	}
+
+	dayOfMonth, err := strconv.Atoi(strings.TrimSpace(date))
+	if err != nil || dayOfMonth < 1 || dayOfMonth > 31 {
+		return time.Time{}, false
+	}
+
+	return time.Date(year, monthOfYear, dayOfMonth, 0, 0, 0, 0, PlannerLocation), true
+}
+
+// plannerMonth parses a planner month header, returning a zero year when the
+// header doesn't carry one.
+func plannerMonth(header string) (time.Month, int, bool) {
+	monthNames := []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+	header = strings.TrimSpace(header)
+	if len(header) < 3 {
+		return 0, 0, false
+	}
+
+	monthIndex := -1
+	for i, name := range monthNames {
+		if strings.EqualFold(header[:3], name) {
+			monthIndex = i
+			break
+		}
+	}
+	if monthIndex < 0 {
+		return 0, 0, false
+	}
+
+	year := 0
+	if parts := strings.Split(header, "'"); len(parts) > 1 {
+		if yy, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil {
+			year = 2000 + yy
+		}
+	}
+	return time.Month(monthIndex + 1), year, true
+}
+
+// PlannerYears resolves the year of each planner month header. The planner
+// runs in month order, so the year rolls over wherever the months wrap from
+// December to January. Headers without a year take it from the nearest one
+// that has one; when none do, the planner is placed in whichever year puts
+// it closest to now.
+func PlannerYears(headers []string, now time.Time) []int {
+	months := make([]time.Month, len(headers))
+	explicit := make([]int, len(headers))
+	rollovers := make([]int, len(headers))
+
+	rollover := 0
+	var previous time.Month
+	first, last := -1, -1
+	for i, header := range headers {
+		month, year, ok := plannerMonth(header)
+		if ok {
+			if previous != 0 && month < previous {
+				rollover++
+			}
+			previous = month
+			months[i], explicit[i] = month, year
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+		rollovers[i] = rollover
+	}
+
+	base := now.Year()
+	anchored := false
+	for i, year := range explicit {
+		if year != 0 {
+			base = year - rollovers[i]
+			anchored = true
+			break
+		}
+	}
+	if !anchored && first >= 0 {
+		best := time.Duration(-1)
+		for _, candidate := range []int{now.Year() - 1, now.Year(), now.Year() + 1} {
+			start := time.Date(candidate+rollovers[first], months[first], 1, 0, 0, 0, 0, now.Location())
+			end := time.Date(candidate+rollovers[last], months[last]+1, 1, 0, 0, 0, 0, now.Location())
+			distance := time.Duration(0)
+			if now.Before(start) {
+				distance = start.Sub(now)
+			} else if !now.Before(end) {
+				distance = now.Sub(end)
+			}
+			if best < 0 || distance < best || (distance == best && candidate == now.Year()) {
+				best = distance
+				base = candidate
+			}
+		}
+	}
+
+	years := make([]int, len(headers))
+	for i := range headers {
+		years[i] = base + rollovers[i]
+		if explicit[i] != 0 {
+			years[i] = explicit[i]
+		}
+	}
+	return years
+}
+
+// CalendarEntries flattens the planner into classified, chronologically
+// ordered entries. Days whose date can't be resolved are skipped.
+func CalendarEntries(calendar *types.CalendarResponse) []types.CalendarEntry {
+	var entries []types.CalendarEntry
+	if calendar == nil {
+		return entries
+	}
+
+	headers := make([]string, len(calendar.Calendar))
+	for i, month := range calendar.Calendar {
+		headers[i] = month.Month
+	}
+	years := PlannerYears(headers, time.Now().In(PlannerLocation))
+
+	for i, month := range calendar.Calendar {
+		for _, day := range month.Days {
+			date, ok := PlannerDate(month.Month, years[i], day.Date)
+			if !ok {
+				continue
+			}
+			categories := day.Categories
+			if categories == nil {
+				categories = ClassifyDay(day)
+			}
+			entries = append(entries, types.CalendarEntry{
+				Date:       date.Format("2006-01-02"),
+				Month:      month.Month,
+				Day:        day.Day,
+				DayOrder:   day.DayOrder,
+				Event:      day.Event,
+				Categories: categories,
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date < entries[j].Date
+	})
+	return entries
+}
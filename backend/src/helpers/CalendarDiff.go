@@ -0,0 +1,147 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"goscraper/src/types"
+	"sort"
+	"strings"
+	"time"
+)
+
+type plannerDay struct {
+	month string
+	day   types.Day
+}
+
+// plannerDays indexes the planner's days by month and day of the month,
+// keeping the first of any day listed twice. Categories are derived from the
+// rest of the day and left out.
+func plannerDays(calendar *types.CalendarResponse) map[string]plannerDay {
+	days := make(map[string]plannerDay)
+	if calendar == nil {
+		return days
+	}
+	for _, month := range calendar.Calendar {
+		for _, day := range month.Days {
+			key := plannerKey(month.Month, day.Date)
+			if _, ok := days[key]; ok {
+				continue
+			}
+			day.Categories = nil
+			days[key] = plannerDay{month: month.Month, day: day}
+		}
+	}
+	return days
+}
+
+func sameDay(a types.Day, b types.Day) bool {
+	return a.Date == b.Date && a.Day == b.Day && a.DayOrder == b.DayOrder && a.Event == b.Event
+}
+
+func plannerKey(month string, date string) string {
+	return strings.TrimSpace(month) + "\x00" + strings.TrimSpace(date)
+}
+
+func sortedPlannerKeys(days map[string]plannerDay) []string {
+	keys := make([]string, 0, len(days))
+	for key := range days {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CalendarHash fingerprints the planner's days so an unchanged planner can be
+// recognised without comparing it day by day.
+func CalendarHash(calendar *types.CalendarResponse) string {
+	days := plannerDays(calendar)
+	hash := sha256.New()
+	for _, key := range sortedPlannerKeys(days) {
+		day := days[key].day
+		for _, field := range []string{key, day.Day, day.DayOrder, day.Event} {
+			hash.Write([]byte(field))
+			hash.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// DiffCalendar lists the days added, changed or removed between the stored
+// planner and a freshly scraped one, in date order. Days whose date can't be
+// resolved come last.
+func DiffCalendar(term string, stored *types.CalendarResponse, scraped *types.CalendarResponse, now time.Time) []types.CalendarChange {
+	before := plannerDays(stored)
+	after := plannerDays(scraped)
+	changedAt := now.UnixNano() / int64(time.Millisecond)
+
+	var changes []types.CalendarChange
+	for _, key := range sortedPlannerKeys(after) {
+		next := after[key]
+		change := types.CalendarChange{
+			Term:      term,
+			Month:     next.month,
+			Date:      next.day.Date,
+			After:     &next.day,
+			ChangedAt: changedAt,
+		}
+		previous, ok := before[key]
+		switch {
+		case !ok:
+			change.Change = types.CalendarChangeAdded
+		case !sameDay(previous.day, next.day):
+			change.Change = types.CalendarChangeUpdated
+			change.Before = &previous.day
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	for _, key := range sortedPlannerKeys(before) {
+		if _, ok := after[key]; ok {
+			continue
+		}
+		previous := before[key]
+		changes = append(changes, types.CalendarChange{
+			Term:      term,
+			Month:     previous.month,
+			Date:      previous.day.Date,
+			Change:    types.CalendarChangeRemoved,
+			Before:    &previous.day,
+			ChangedAt: changedAt,
+		})
+	}
+
+	years := plannerHeaderYears(now, stored, scraped)
+	dateOf := func(change types.CalendarChange) (time.Time, bool) {
+		return PlannerDate(change.Month, years[strings.TrimSpace(change.Month)], change.Date)
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, aok := dateOf(changes[i])
+		b, bok := dateOf(changes[j])
+		if aok != bok {
+			return aok
+		}
+		return aok && a.Before(b)
+	})
+	return changes
+}
+
+// plannerHeaderYears resolves the year of every month header in the planners.
+// The scraped planner is resolved last, so its years win.
+func plannerHeaderYears(now time.Time, calendars ...*types.CalendarResponse) map[string]int {
+	years := make(map[string]int)
+	for _, calendar := range calendars {
+		if calendar == nil {
+			continue
+		}
+		headers := make([]string, len(calendar.Calendar))
+		for i, month := range calendar.Calendar {
+			headers[i] = month.Month
+		}
+		for i, year := range PlannerYears(headers, now) {
+			years[strings.TrimSpace(headers[i])] = year
+		}
+	}
+	return years
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"goscraper/src/types"
 	"goscraper/src/utils"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +22,17 @@ func init() {
     // }
 }
 
+const defaultPlannerTerm = "2025_26_ODD"
+
+// PlannerTerm is the academic planner scraped and stored, from PLANNER_TERM,
+// such as "2025_26_ODD".
+func PlannerTerm() string {
+	if term := strings.TrimSpace(os.Getenv("PLANNER_TERM")); term != "" {
+		return term
+	}
+	return defaultPlannerTerm
+}
+
 type CalendarFetcher struct {
 	cookie string
 	date   time.Time
@@ -40,7 +52,7 @@ func (c *CalendarFetcher) GetCalendar() (*types.CalendarResponse, error) {
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	req.SetRequestURI("https://academia.srmist.edu.in/srm_university/academia-academic-services/page/Academic_Planner_2025_26_ODD")
+	req.SetRequestURI("https://academia.srmist.edu.in/srm_university/academia-academic-services/page/Academic_Planner_" + PlannerTerm())
 	req.Header.SetMethod("GET")
 	req.Header.Set("accept", "*/*")
 	req.Header.Set("accept-language", "en-US,en;q=0.9")
@@ -0,0 +1,208 @@
+package helpers
+
+import (
+	"goscraper/src/types"
+	"math"
+	"sort"
+	"strings"
+)
+
+// CohortContribution is one student's cached data as fed to the cohort
+// aggregation. It never leaves the aggregation.
+type CohortContribution struct {
+	Section    string
+	Attendance *types.AttendanceResponse
+	Marks      *types.MarksResponse
+}
+
+type cohortBucket struct {
+	students   int
+	attendance map[string][]float64
+	tests      map[string][]float64
+	testInfo   map[string]types.CohortTestStat
+}
+
+func newCohortBucket() *cohortBucket {
+	return &cohortBucket{
+		attendance: make(map[string][]float64),
+		tests:      make(map[string][]float64),
+		testInfo:   make(map[string]types.CohortTestStat),
+	}
+}
+
+// CohortKey is the key of a course's cohort, optionally narrowed to a section.
+func CohortKey(courseCode string, section string) string {
+	key := courseCodeKey(courseCode)
+	if section = normalizeSection(section); section != "" {
+		key += "|" + section
+	}
+	return key
+}
+
+func normalizeSection(section string) string {
+	return strings.ToUpper(strings.TrimSpace(section))
+}
+
+// BuildCohortStats aggregates attendance percentages and test scores per
+// course and per course and section. Only values with at least
+// minContributors students are kept, and groups left with nothing to publish
+// are dropped. A section value is also withheld when the students outside
+// the section are too few, since subtracting it from the course value would
+// expose them.
+func BuildCohortStats(contributions []CohortContribution, minContributors int) map[string]types.CohortGroup {
+	buckets := make(map[string]*cohortBucket)
+	bucket := func(key string) *cohortBucket {
+		if buckets[key] == nil {
+			buckets[key] = newCohortBucket()
+		}
+		return buckets[key]
+	}
+
+	for _, contribution := range contributions {
+		section := normalizeSection(contribution.Section)
+		courses := make(map[string]bool)
+
+		if contribution.Attendance != nil {
+			for _, course := range contribution.Attendance.Attendance {
+				attended, conducted := AttendedHours(course)
+				if conducted == 0 {
+					continue
+				}
+				percentage := float64(attended) / float64(conducted) * 100
+				category := strings.TrimSpace(course.Category)
+				for _, key := range cohortKeys(course.CourseCode, section) {
+					b := bucket(key)
+					b.attendance[category] = append(b.attendance[category], percentage)
+				}
+				courses[courseCodeKey(course.CourseCode)] = true
+			}
+		}
+
+		if contribution.Marks != nil {
+			for _, mark := range contribution.Marks.Marks {
+				for _, test := range mark.TestPerformance {
+					scored := strings.TrimSpace(test.Marks.Scored)
+					if strings.EqualFold(scored, "Abs") || scored == "" {
+						continue
+					}
+					info := types.CohortTestStat{
+						CourseType: strings.TrimSpace(mark.CourseType),
+						Test:       strings.TrimSpace(test.Test),
+						Total:      parseMark(test.Marks.Total),
+					}
+					testKey := strings.ToLower(info.CourseType + "|" + info.Test + "|" + test.Marks.Total)
+					for _, key := range cohortKeys(mark.CourseCode, section) {
+						b := bucket(key)
+						b.tests[testKey] = append(b.tests[testKey], parseMark(scored))
+						b.testInfo[testKey] = info
+					}
+				}
+				courses[courseCodeKey(mark.CourseCode)] = true
+			}
+		}
+
+		for code := range courses {
+			for _, key := range cohortKeys(code, section) {
+				bucket(key).students++
+			}
+		}
+	}
+
+	// publishable reports whether n of total students can be shown; a section
+	// of total students must leave none or enough of them outside it.
+	publishable := func(n int, total int, section bool) bool {
+		if n < minContributors {
+			return false
+		}
+		rest := total - n
+		return !section || rest == 0 || rest >= minContributors
+	}
+
+	groups := make(map[string]types.CohortGroup)
+	for key, b := range buckets {
+		course := b
+		section := strings.Contains(key, "|")
+		if section {
+			course = buckets[key[:strings.Index(key, "|")]]
+		}
+		if !publishable(b.students, course.students, section) {
+			continue
+		}
+
+		group := types.CohortGroup{
+			Contributors: b.students,
+			Attendance:   []types.CohortAttendanceStat{},
+			Tests:        []types.CohortTestStat{},
+		}
+		if i := strings.Index(key, "|"); i != -1 {
+			group.Section = key[i+1:]
+		}
+
+		for category, values := range b.attendance {
+			if publishable(len(values), len(course.attendance[category]), section) {
+				group.Attendance = append(group.Attendance, types.CohortAttendanceStat{
+					Category: category,
+					Stat:     cohortStat(values),
+				})
+			}
+		}
+		for testKey, values := range b.tests {
+			if publishable(len(values), len(course.tests[testKey]), section) {
+				test := b.testInfo[testKey]
+				test.Stat = cohortStat(values)
+				group.Tests = append(group.Tests, test)
+			}
+		}
+		if len(group.Attendance) == 0 && len(group.Tests) == 0 {
+			continue
+		}
+
+		sort.Slice(group.Attendance, func(i, j int) bool {
+			return group.Attendance[i].Category < group.Attendance[j].Category
+		})
+		sort.Slice(group.Tests, func(i, j int) bool {
+			if group.Tests[i].CourseType != group.Tests[j].CourseType {
+				return group.Tests[i].CourseType > group.Tests[j].CourseType
+			}
+			return group.Tests[i].Test < group.Tests[j].Test
+		})
+		groups[key] = group
+	}
+	return groups
+}
+
+func cohortKeys(courseCode string, section string) []string {
+	keys := []string{CohortKey(courseCode, "")}
+	if section != "" {
+		keys = append(keys, CohortKey(courseCode, section))
+	}
+	return keys
+}
+
+func cohortStat(values []float64) types.CohortStat {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, value := range sorted {
+		sum += value
+	}
+	return types.CohortStat{
+		Contributors: len(sorted),
+		Mean:         roundMarks(sum / float64(len(sorted))),
+		Median:       roundMarks(quantile(sorted, 0.5)),
+		P25:          roundMarks(quantile(sorted, 0.25)),
+		P75:          roundMarks(quantile(sorted, 0.75)),
+	}
+}
+
+// quantile interpolates linearly between the closest ranks of sorted values.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
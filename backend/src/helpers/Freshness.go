@@ -0,0 +1,96 @@
+package helpers
+
+import (
+	"goscraper/src/types"
+	"os"
+	"strings"
+	"time"
+)
+
+// Cached sections of a student's data.
+const (
+	SectionUser       = "user"
+	SectionAttendance = "attendance"
+	SectionMarks      = "marks"
+	SectionCourses    = "courses"
+	SectionTimetable  = "timetable"
+)
+
+// Sections lists every cached section.
+var Sections = []string{SectionUser, SectionAttendance, SectionMarks, SectionCourses, SectionTimetable}
+
+const defaultSectionTTL = time.Hour
+
+// sectionSources names the portal page each section is parsed from.
+var sectionSources = map[string]string{
+	SectionUser:       "My_Time_Table_2023_24",
+	SectionAttendance: "My_Attendance",
+	SectionMarks:      "My_Attendance",
+	SectionCourses:    "My_Time_Table_2023_24",
+	SectionTimetable:  "My_Time_Table_2023_24",
+}
+
+// parserVersions is bumped whenever a parser's output changes shape, so data
+// cached by an older parser is no longer reported fresh.
+var parserVersions = map[string]string{
+	SectionUser:       "1",
+	SectionAttendance: "1",
+	SectionMarks:      "1",
+	SectionCourses:    "1",
+	SectionTimetable:  "2",
+}
+
+// ParserVersion returns the current parser version of a section.
+func ParserVersion(section string) string {
+	return parserVersions[section]
+}
+
+// SectionTTL is how long a cached section stays fresh, from
+// CACHE_TTL_<SECTION> (for example CACHE_TTL_MARKS), then CACHE_TTL, then an
+// hour.
+func SectionTTL(section string) time.Duration {
+	for _, name := range []string{"CACHE_TTL_" + strings.ToUpper(section), "CACHE_TTL"} {
+		if raw := os.Getenv(name); raw != "" {
+			if ttl, err := time.ParseDuration(raw); err == nil && ttl >= 0 {
+				return ttl
+			}
+		}
+	}
+	return defaultSectionTTL
+}
+
+// NewSectionMeta describes a section fetched now by the current parser.
+func NewSectionMeta(section string) types.SectionMeta {
+	return SectionMetaAt(section, time.Now().UnixNano()/int64(time.Millisecond))
+}
+
+// SectionMetaAt describes a section fetched by the current parser at the given
+// time in milliseconds.
+func SectionMetaAt(section string, fetchedAt int64) types.SectionMeta {
+	return types.SectionMeta{
+		FetchedAt:     fetchedAt,
+		Source:        sectionSources[section],
+		ParserVersion: ParserVersion(section),
+	}
+}
+
+// SectionFreshness reports the age of a cached section at now.
+func SectionFreshness(section string, meta types.SectionMeta, now time.Time) types.SectionFreshness {
+	ttl := SectionTTL(section)
+	age := now.Sub(time.UnixMilli(meta.FetchedAt))
+	if age < 0 {
+		age = 0
+	}
+	return types.SectionFreshness{
+		SectionMeta: meta,
+		AgeSeconds:  int64(age / time.Second),
+		TTLSeconds:  int64(ttl / time.Second),
+		Fresh:       age < ttl && meta.ParserVersion == ParserVersion(section),
+	}
+}
+
+// FreshSection reports a section that was just scraped.
+func FreshSection(section string) *types.SectionFreshness {
+	freshness := SectionFreshness(section, NewSectionMeta(section), time.Now())
+	return &freshness
+}
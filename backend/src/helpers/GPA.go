@@ -0,0 +1,149 @@
+package helpers
+
+import (
+	"fmt"
+	"goscraper/src/types"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ValidateGradeEntries checks that entered grades are known grades and that
+// credits are positive.
+func ValidateGradeEntries(entries []types.GradeEntry) error {
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		code := courseCodeKey(entry.CourseCode)
+		if code == "" {
+			return fmt.Errorf("course code is required")
+		}
+		if seen[code] {
+			return fmt.Errorf("course %s is listed more than once", entry.CourseCode)
+		}
+		seen[code] = true
+		if entry.Credit <= 0 {
+			return fmt.Errorf("course %s needs a positive credit", entry.CourseCode)
+		}
+		if _, ok := GradePoints(entry.Grade); !ok {
+			return fmt.Errorf("course %s has unknown grade %q", entry.CourseCode, entry.Grade)
+		}
+	}
+	return nil
+}
+
+// ValidateWhatIfGrades checks that every hypothetical grade is a known grade.
+func ValidateWhatIfGrades(grades map[string]string) error {
+	for code, grade := range grades {
+		if _, ok := GradePoints(grade); !ok {
+			return fmt.Errorf("course %s has unknown grade %q", code, grade)
+		}
+	}
+	return nil
+}
+
+// CurrentSemesterGrades lists the credited courses of the current semester.
+// Grades come from the what-if scenario first, then from grades the student
+// entered for the semester.
+func CurrentSemesterGrades(courses []types.Course, entered []types.GradeEntry, whatIf map[string]string) []types.GradeEntry {
+	enteredGrades := make(map[string]string)
+	for _, entry := range entered {
+		enteredGrades[courseCodeKey(entry.CourseCode)] = entry.Grade
+	}
+	whatIfGrades := make(map[string]string)
+	for code, grade := range whatIf {
+		whatIfGrades[courseCodeKey(code)] = grade
+	}
+
+	var entries []types.GradeEntry
+	seen := make(map[string]bool)
+	for _, course := range courses {
+		code := courseCodeKey(course.Code)
+		credit := parseMark(course.Credit)
+		if code == "" || credit <= 0 || seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		entry := types.GradeEntry{
+			CourseCode:  strings.TrimSpace(course.Code),
+			CourseTitle: course.Title,
+			Credit:      credit,
+		}
+		if grade, ok := whatIfGrades[code]; ok {
+			entry.Grade = grade
+			entry.Source = types.GradeSourceWhatIf
+		} else if grade, ok := enteredGrades[code]; ok {
+			entry.Grade = grade
+			entry.Source = types.GradeSourceEntered
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// SemesterGPA computes the SGPA over the graded courses of a semester.
+func SemesterGPA(semester int, entries []types.GradeEntry) types.SemesterGPA {
+	result := types.SemesterGPA{
+		Semester: semester,
+		Courses:  []types.GradeEntry{},
+	}
+
+	var points float64
+	for _, entry := range entries {
+		if entry.Grade != "" {
+			entry.Points, _ = GradePoints(entry.Grade)
+			result.Credits += entry.Credit
+			points += entry.Credit * float64(entry.Points)
+		}
+		result.Courses = append(result.Courses, entry)
+	}
+	if result.Credits > 0 {
+		result.SGPA = roundGPA(points / result.Credits)
+	}
+	return result
+}
+
+// BuildGPA combines the stored past semesters with the current one into a
+// CGPA weighted by credits.
+func BuildGPA(regNumber string, currentSemester int, past map[int][]types.GradeEntry, current []types.GradeEntry) *types.GPAResponse {
+	response := &types.GPAResponse{
+		RegNumber:       regNumber,
+		CurrentSemester: currentSemester,
+		Semesters:       []types.SemesterGPA{},
+	}
+
+	var semesters []int
+	for semester := range past {
+		if semester != currentSemester {
+			semesters = append(semesters, semester)
+		}
+	}
+	sort.Ints(semesters)
+
+	var points float64
+	add := func(semester types.SemesterGPA) {
+		response.Semesters = append(response.Semesters, semester)
+		response.Credits += semester.Credits
+		for _, course := range semester.Courses {
+			if course.Grade != "" {
+				points += course.Credit * float64(course.Points)
+			}
+		}
+	}
+	for _, semester := range semesters {
+		for i := range past[semester] {
+			past[semester][i].Source = types.GradeSourceEntered
+		}
+		add(SemesterGPA(semester, past[semester]))
+	}
+	add(SemesterGPA(currentSemester, current))
+
+	if response.Credits > 0 {
+		response.CGPA = roundGPA(points / response.Credits)
+	}
+	return response
+}
+
+func roundGPA(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,260 @@
+package helpers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"goscraper/src/types"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed data/grading.json
+var defaultGradingModel []byte
+
+// CourseWeightage splits a course's 100 marks between internal assessment and
+// the end-semester exam, whose paper is marked out of EndSemMax.
+type CourseWeightage struct {
+	Internal  float64 `json:"internal"`
+	EndSem    float64 `json:"endSem"`
+	EndSemMax float64 `json:"endSemMax"`
+}
+
+type GradeBand struct {
+	Grade  string  `json:"grade"`
+	Min    float64 `json:"min"`
+	Points int     `json:"points"`
+}
+
+// GradingModel holds the weightage of each course type and the grade bands,
+// highest grade first.
+type GradingModel struct {
+	Version           int                        `json:"version"`
+	DefaultCourseType string                     `json:"defaultCourseType"`
+	CourseTypes       map[string]CourseWeightage `json:"courseTypes"`
+	Grades            []GradeBand                `json:"grades"`
+}
+
+var (
+	gradingModelMu sync.RWMutex
+	gradingModel   *GradingModel
+)
+
+// LoadGradingModel reads the grading model from GRADING_MODEL_PATH, falling
+// back to the model bundled with the binary.
+func LoadGradingModel() (*GradingModel, error) {
+	raw := defaultGradingModel
+	if path := os.Getenv("GRADING_MODEL_PATH"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read grading model: %v", err)
+		}
+		raw = data
+	}
+
+	model, err := parseGradingModel(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	gradingModelMu.Lock()
+	gradingModel = model
+	gradingModelMu.Unlock()
+	return model, nil
+}
+
+func parseGradingModel(raw []byte) (*GradingModel, error) {
+	var model GradingModel
+	if err := json.Unmarshal(raw, &model); err != nil {
+		return nil, fmt.Errorf("invalid grading model: %v", err)
+	}
+
+	courseTypes := make(map[string]CourseWeightage, len(model.CourseTypes))
+	for name, weightage := range model.CourseTypes {
+		if weightage.Internal < 0 || weightage.EndSem < 0 || weightage.Internal+weightage.EndSem != 100 {
+			return nil, fmt.Errorf("grading model: weightage for %q must add up to 100", name)
+		}
+		if weightage.EndSem > 0 && weightage.EndSemMax <= 0 {
+			return nil, fmt.Errorf("grading model: %q needs an end-semester maximum", name)
+		}
+		courseTypes[strings.ToLower(strings.TrimSpace(name))] = weightage
+	}
+	model.CourseTypes = courseTypes
+	model.DefaultCourseType = strings.ToLower(strings.TrimSpace(model.DefaultCourseType))
+	if _, ok := model.CourseTypes[model.DefaultCourseType]; !ok {
+		return nil, fmt.Errorf("grading model: unknown default course type %q", model.DefaultCourseType)
+	}
+
+	if len(model.Grades) == 0 {
+		return nil, fmt.Errorf("grading model: no grades defined")
+	}
+	sort.SliceStable(model.Grades, func(i, j int) bool {
+		return model.Grades[i].Min > model.Grades[j].Min
+	})
+	seen := make(map[string]bool)
+	for _, band := range model.Grades {
+		if band.Grade == "" || seen[strings.ToUpper(band.Grade)] {
+			return nil, fmt.Errorf("grading model: missing or duplicate grade %q", band.Grade)
+		}
+		seen[strings.ToUpper(band.Grade)] = true
+	}
+	if model.Grades[len(model.Grades)-1].Min != 0 {
+		return nil, fmt.Errorf("grading model: the lowest grade must start at 0")
+	}
+	return &model, nil
+}
+
+func getGradingModel() *GradingModel {
+	gradingModelMu.RLock()
+	model := gradingModel
+	gradingModelMu.RUnlock()
+	if model != nil {
+		return model
+	}
+
+	model, err := LoadGradingModel()
+	if err != nil {
+		log.Printf("Falling back to bundled grading model: %v", err)
+		model, _ = parseGradingModel(defaultGradingModel)
+		gradingModelMu.Lock()
+		gradingModel = model
+		gradingModelMu.Unlock()
+	}
+	return model
+}
+
+// WeightageFor returns the weightage of a course type, or of the default
+// course type when it isn't configured.
+func WeightageFor(courseType string) CourseWeightage {
+	model := getGradingModel()
+	if weightage, ok := model.CourseTypes[strings.ToLower(strings.TrimSpace(courseType))]; ok {
+		return weightage
+	}
+	return model.CourseTypes[model.DefaultCourseType]
+}
+
+// GradeBands returns the grade bands, highest grade first.
+func GradeBands() []GradeBand {
+	return getGradingModel().Grades
+}
+
+// GradeFor returns the band a total out of 100 falls in.
+func GradeFor(total float64) GradeBand {
+	grades := GradeBands()
+	for _, band := range grades {
+		if total >= band.Min {
+			return band
+		}
+	}
+	return grades[len(grades)-1]
+}
+
+// GradePoints returns the points for a grade letter.
+func GradePoints(grade string) (int, bool) {
+	for _, band := range GradeBands() {
+		if strings.EqualFold(band.Grade, strings.TrimSpace(grade)) {
+			return band.Points, true
+		}
+	}
+	return 0, false
+}
+
+// MarksTargets works out each course's internal total and the end-semester
+// score needed for every passing grade. Tests whose maxima don't fit the
+// internal weightage are reported as warnings.
+func MarksTargets(marks *types.MarksResponse) *types.MarksTargetsResponse {
+	response := &types.MarksTargetsResponse{
+		RegNumber: marks.RegNumber,
+		Courses:   []types.CourseMarksTargets{},
+		Stale:     marks.Stale,
+	}
+	for _, mark := range marks.Marks {
+		response.Courses = append(response.Courses, CourseTargets(mark))
+	}
+	return response
+}
+
+// CourseTargets computes the grade targets for a single course.
+func CourseTargets(mark types.Mark) types.CourseMarksTargets {
+	weightage := WeightageFor(mark.CourseType)
+	course := types.CourseMarksTargets{
+		CourseCode:   mark.CourseCode,
+		CourseName:   mark.CourseName,
+		CourseType:   mark.CourseType,
+		InternalMax:  weightage.Internal,
+		EndSemWeight: weightage.EndSem,
+		EndSemMax:    weightage.EndSemMax,
+		Targets:      []types.GradeTarget{},
+		Warnings:     []types.MarksWarning{},
+	}
+
+	seen := make(map[string]bool)
+	for _, test := range mark.TestPerformance {
+		total := parseMark(test.Marks.Total)
+		scored := parseMark(test.Marks.Scored)
+
+		name := strings.TrimSpace(test.Test)
+		if seen[strings.ToLower(name)] {
+			course.Warnings = append(course.Warnings, types.MarksWarning{Test: name, Message: "test is listed more than once"})
+		}
+		seen[strings.ToLower(name)] = true
+
+		if total <= 0 {
+			course.Warnings = append(course.Warnings, types.MarksWarning{Test: name, Message: "test has no maximum"})
+		}
+		if scored > total {
+			course.Warnings = append(course.Warnings, types.MarksWarning{
+				Test:    name,
+				Message: fmt.Sprintf("scored %.2f is more than the maximum %.2f", scored, total),
+			})
+		}
+
+		course.InternalScored += scored
+		course.InternalPublished += total
+	}
+	course.InternalScored = roundMarks(course.InternalScored)
+	course.InternalPublished = roundMarks(course.InternalPublished)
+
+	if course.InternalPublished > weightage.Internal {
+		course.Warnings = append(course.Warnings, types.MarksWarning{
+			Message: fmt.Sprintf("test maxima add up to %.2f, more than the internal weightage of %.2f", course.InternalPublished, weightage.Internal),
+		})
+	}
+
+	internal := math.Min(course.InternalScored, weightage.Internal)
+	for _, band := range GradeBands() {
+		if band.Min <= 0 {
+			continue
+		}
+		required := math.Max(band.Min-internal, 0)
+		target := types.GradeTarget{
+			Grade:      band.Grade,
+			Points:     band.Points,
+			Required:   roundMarks(required),
+			Secured:    required == 0,
+			Achievable: required <= weightage.EndSem,
+		}
+		if weightage.EndSem > 0 {
+			target.RequiredRaw = math.Ceil(required/weightage.EndSem*weightage.EndSemMax*100) / 100
+		}
+		course.Targets = append(course.Targets, target)
+	}
+	return course
+}
+
+// parseMark reads a scraped score, treating "Abs" and other text as zero.
+func parseMark(value string) float64 {
+	var f float64
+	if _, err := fmt.Sscanf(strings.TrimSpace(value), "%f", &f); err != nil {
+		return 0
+	}
+	return f
+}
+
+func roundMarks(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,66 @@
+package helpers
+
+import "goscraper/src/types"
+
+// compactable is one snapshot as compaction sees it: which series it belongs
+// to and when it was taken.
+type compactable struct {
+	id        int64
+	key       string
+	scrapedAt int64
+}
+
+// redundantSnapshots returns the ids of snapshots taken before the given time
+// that aren't the last of their series on their day. Those are the ones
+// compaction removes, leaving old history at one snapshot per day.
+func redundantSnapshots(snapshots []compactable, before int64) []int64 {
+	last := make(map[string]compactable)
+	for _, snapshot := range snapshots {
+		if snapshot.scrapedAt >= before {
+			continue
+		}
+		day := snapshot.key + "|" + snapshotDate(snapshot.scrapedAt)
+		if previous, ok := last[day]; !ok || snapshot.scrapedAt >= previous.scrapedAt {
+			last[day] = snapshot
+		}
+	}
+
+	var redundant []int64
+	for _, snapshot := range snapshots {
+		if snapshot.scrapedAt >= before || snapshot.id == 0 {
+			continue
+		}
+		if last[snapshot.key+"|"+snapshotDate(snapshot.scrapedAt)].id != snapshot.id {
+			redundant = append(redundant, snapshot.id)
+		}
+	}
+	return redundant
+}
+
+// RedundantAttendanceSnapshots returns the attendance snapshots taken before
+// the given time, in milliseconds, that compaction can remove.
+func RedundantAttendanceSnapshots(snapshots []types.AttendanceSnapshot, before int64) []int64 {
+	entries := make([]compactable, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		entries = append(entries, compactable{
+			id:        snapshot.ID,
+			key:       snapshotKey(snapshot.CourseCode, snapshot.Category),
+			scrapedAt: snapshot.ScrapedAt,
+		})
+	}
+	return redundantSnapshots(entries, before)
+}
+
+// RedundantMarkSnapshots returns the test score snapshots taken before the
+// given time, in milliseconds, that compaction can remove.
+func RedundantMarkSnapshots(snapshots []types.MarkSnapshot, before int64) []int64 {
+	entries := make([]compactable, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		entries = append(entries, compactable{
+			id:        snapshot.ID,
+			key:       markSnapshotKey(snapshot.CourseCode, snapshot.CourseType, snapshot.Test),
+			scrapedAt: snapshot.ScrapedAt,
+		})
+	}
+	return redundantSnapshots(entries, before)
+}
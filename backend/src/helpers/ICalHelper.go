@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"fmt"
+	"goscraper/src/types"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const icalTimezone = "Asia/Kolkata"
+
+// BuildICalendar expands the timetable over every working day in the planner
+// and adds holidays and exams as all-day events. Consecutive periods of the
+// same course become a single event.
+func BuildICalendar(name string, entries []types.CalendarEntry, timetable *types.TimetableResult, now time.Time) string {
+	var b strings.Builder
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	writeLine(&b, "BEGIN:VCALENDAR")
+	writeLine(&b, "VERSION:2.0")
+	writeLine(&b, "PRODID:-//Vertex//Timetable//EN")
+	writeLine(&b, "CALSCALE:GREGORIAN")
+	writeLine(&b, "METHOD:PUBLISH")
+	writeLine(&b, "X-WR-CALNAME:"+escapeICalText(name))
+	writeLine(&b, "X-WR-TIMEZONE:"+icalTimezone)
+	writeLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:PT6H")
+	writeLine(&b, "X-PUBLISHED-TTL:PT6H")
+	writeLine(&b, "BEGIN:VTIMEZONE")
+	writeLine(&b, "TZID:"+icalTimezone)
+	writeLine(&b, "BEGIN:STANDARD")
+	writeLine(&b, "DTSTART:19700101T000000")
+	writeLine(&b, "TZOFFSETFROM:+0530")
+	writeLine(&b, "TZOFFSETTO:+0530")
+	writeLine(&b, "TZNAME:IST")
+	writeLine(&b, "END:STANDARD")
+	writeLine(&b, "END:VTIMEZONE")
+
+	for _, entry := range entries {
+		date, err := time.ParseInLocation("2006-01-02", entry.Date, PlannerLocation)
+		if err != nil {
+			continue
+		}
+		day := date.Format("20060102")
+
+		if HasCategory(entry.Categories, types.DayCategoryHoliday) || HasCategory(entry.Categories, types.DayCategoryExam) {
+			summary := entry.Event
+			if summary == "" {
+				summary = "Holiday"
+			}
+			writeLine(&b, "BEGIN:VEVENT")
+			writeLine(&b, fmt.Sprintf("UID:%s-event@vertex", day))
+			writeLine(&b, "DTSTAMP:"+stamp)
+			writeLine(&b, "DTSTART;VALUE=DATE:"+day)
+			writeLine(&b, "DTEND;VALUE=DATE:"+date.AddDate(0, 0, 1).Format("20060102"))
+			writeLine(&b, "SUMMARY:"+escapeICalText(summary))
+			writeLine(&b, "CATEGORIES:"+strings.ToUpper(strings.Join(entry.Categories, ",")))
+			writeLine(&b, "TRANSP:TRANSPARENT")
+			writeLine(&b, "END:VEVENT")
+		}
+
+		dayOrder, ok := ParseDayOrder(entry.DayOrder)
+		if !ok || timetable == nil {
+			continue
+		}
+
+		classes := ClassesForDayOrder(timetable, dayOrder)
+		if timing := TimingForDate(date); timing != "" {
+			if profile, ok := TimingProfileByName(timing); ok {
+				applyTiming(classes, profile)
+			}
+		}
+
+		for _, class := range mergeConsecutiveClasses(classes) {
+			if class.StartTime == "" || class.EndTime == "" {
+				continue
+			}
+			start := strings.ReplaceAll(class.StartTime, ":", "") + "00"
+			end := strings.ReplaceAll(class.EndTime, ":", "") + "00"
+
+			description := fmt.Sprintf("%s · Day %d · Slot %s", class.Code, dayOrder, class.Slot)
+			writeLine(&b, "BEGIN:VEVENT")
+			writeLine(&b, fmt.Sprintf("UID:%s-p%d-%s@vertex", day, class.Period, strings.ReplaceAll(class.Code, "/", "-")))
+			writeLine(&b, "DTSTAMP:"+stamp)
+			writeLine(&b, fmt.Sprintf("DTSTART;TZID=%s:%sT%s", icalTimezone, day, start))
+			writeLine(&b, fmt.Sprintf("DTEND;TZID=%s:%sT%s", icalTimezone, day, end))
+			writeLine(&b, "SUMMARY:"+escapeICalText(class.Name))
+			writeLine(&b, "DESCRIPTION:"+escapeICalText(description))
+			if class.RoomNo != "" && class.RoomNo != "N/A" {
+				writeLine(&b, "LOCATION:"+escapeICalText(class.RoomNo))
+			}
+			writeLine(&b, "CATEGORIES:"+strings.ToUpper(class.CourseType))
+			writeLine(&b, "END:VEVENT")
+		}
+	}
+
+	writeLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// applyTiming replaces class times with the profile's period times when the
+// profile covers the periods.
+func applyTiming(classes []types.ScheduledClass, profile types.TimingProfile) {
+	for i := range classes {
+		first := classes[i].Period
+		last := first + max(classes[i].Span, 1) - 1
+		if first >= 1 && last <= len(profile.Periods) {
+			classes[i].StartTime = profile.Periods[first-1].Start
+			classes[i].EndTime = profile.Periods[last-1].End
+		}
+	}
+}
+
+func mergeConsecutiveClasses(classes []types.ScheduledClass) []types.ScheduledClass {
+	var merged []types.ScheduledClass
+	lastPeriod := 0
+	for _, class := range classes {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if last.Code == class.Code && last.RoomNo == class.RoomNo && class.Period == lastPeriod+1 {
+				last.EndTime = class.EndTime
+				last.Slot = last.Slot + "-" + class.Slot
+				last.Span += max(class.Span, 1)
+				lastPeriod = class.Period + max(class.Span, 1) - 1
+				continue
+			}
+		}
+		merged = append(merged, class)
+		lastPeriod = class.Period + max(class.Span, 1) - 1
+	}
+	return merged
+}
+
+func escapeICalText(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(text)
+}
+
+// writeLine writes a content line folded at 75 octets as RFC 5545 requires.
+func writeLine(b *strings.Builder, line string) {
+	const limit = 75
+	first := true
+	for len(line) > 0 {
+		max := limit
+		if !first {
+			max = limit - 1
+			b.WriteString(" ")
+		}
+		if len(line) <= max {
+			b.WriteString(line)
+			break
+		}
+		cut := max
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n")
+		line = line[cut:]
+		first = false
+	}
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,111 @@
+package helpers
+
+import (
+	"fmt"
+	"goscraper/src/types"
+	"sort"
+	"strings"
+	"time"
+)
+
+func markSnapshotKey(code string, courseType string, test string) string {
+	return courseCodeKey(code) + "|" + strings.ToLower(strings.TrimSpace(courseType)) + "|" + strings.ToLower(strings.TrimSpace(test))
+}
+
+// LatestMarkSnapshots returns the most recent snapshot of each test.
+func LatestMarkSnapshots(snapshots []types.MarkSnapshot) map[string]types.MarkSnapshot {
+	latest := make(map[string]types.MarkSnapshot)
+	for _, snapshot := range snapshots {
+		key := markSnapshotKey(snapshot.CourseCode, snapshot.CourseType, snapshot.Test)
+		if previous, ok := latest[key]; !ok || snapshot.ScrapedAt >= previous.ScrapedAt {
+			latest[key] = snapshot
+		}
+	}
+	return latest
+}
+
+// ChangedMarkSnapshots turns a scrape into snapshots, keeping only the tests
+// that are new or whose score differs from their latest stored snapshot.
+func ChangedMarkSnapshots(latest map[string]types.MarkSnapshot, marks *types.MarksResponse, scrapedAt time.Time) []types.MarkSnapshot {
+	var changed []types.MarkSnapshot
+	if marks == nil || marks.RegNumber == "" {
+		return changed
+	}
+
+	for _, mark := range marks.Marks {
+		for _, test := range mark.TestPerformance {
+			snapshot := types.MarkSnapshot{
+				RegNumber:  marks.RegNumber,
+				CourseCode: strings.TrimSpace(mark.CourseCode),
+				CourseType: strings.TrimSpace(mark.CourseType),
+				Test:       strings.TrimSpace(test.Test),
+				Scored:     strings.TrimSpace(test.Marks.Scored),
+				Total:      parseMark(test.Marks.Total),
+				ScrapedAt:  scrapedAt.UnixNano() / int64(time.Millisecond),
+			}
+			previous, ok := latest[markSnapshotKey(snapshot.CourseCode, snapshot.CourseType, snapshot.Test)]
+			if ok && previous.Scored == snapshot.Scored && previous.Total == snapshot.Total {
+				continue
+			}
+			changed = append(changed, snapshot)
+		}
+	}
+	return changed
+}
+
+// MarksEvents diffs consecutive snapshots of each test into events newer than
+// since (milliseconds), newest first. Tests in the student's first scrape are
+// the baseline and don't produce events.
+func MarksEvents(snapshots []types.MarkSnapshot, marks *types.MarksResponse, since int64) []types.MarksEvent {
+	events := []types.MarksEvent{}
+	if len(snapshots) == 0 {
+		return events
+	}
+
+	sorted := append([]types.MarkSnapshot(nil), snapshots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ScrapedAt < sorted[j].ScrapedAt
+	})
+	baseline := sorted[0].ScrapedAt
+
+	names := make(map[string]string)
+	if marks != nil {
+		for _, mark := range marks.Marks {
+			names[courseCodeKey(mark.CourseCode)] = mark.CourseName
+		}
+	}
+
+	previous := make(map[string]types.MarkSnapshot)
+	for _, snapshot := range sorted {
+		key := markSnapshotKey(snapshot.CourseCode, snapshot.CourseType, snapshot.Test)
+		prev, seen := previous[key]
+		previous[key] = snapshot
+		if snapshot.ScrapedAt == baseline || snapshot.ScrapedAt <= since {
+			continue
+		}
+
+		event := types.MarksEvent{
+			Type:       types.MarksEventTestPublished,
+			CourseCode: snapshot.CourseCode,
+			CourseName: names[courseCodeKey(snapshot.CourseCode)],
+			CourseType: snapshot.CourseType,
+			Test:       snapshot.Test,
+			Scored:     snapshot.Scored,
+			Total:      snapshot.Total,
+			Date:       snapshotDate(snapshot.ScrapedAt),
+			ScrapedAt:  snapshot.ScrapedAt,
+			Message:    fmt.Sprintf("%s published in %s: %s/%.2f", snapshot.Test, snapshot.CourseCode, snapshot.Scored, snapshot.Total),
+		}
+		if seen {
+			event.Type = types.MarksEventScoreChanged
+			event.PreviousScored = prev.Scored
+			event.Message = fmt.Sprintf("%s score changed in %s: %s to %s/%.2f", snapshot.Test, snapshot.CourseCode, prev.Scored, snapshot.Scored, snapshot.Total)
+		}
+		events = append(events, event)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].ScrapedAt > events[j].ScrapedAt
+	})
+	return events
+}
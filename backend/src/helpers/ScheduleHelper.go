@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"goscraper/src/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDayOrder converts a planner day order such as "3" into its number.
+// Holidays and weekends use "-" and return false.
+func ParseDayOrder(dayOrder string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(dayOrder))
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// TimingForDate picks the timing profile for a date. Saturdays use the
+// "saturday" profile when one is configured; other days use the grid default.
+func TimingForDate(date time.Time) string {
+	if date.Weekday() != time.Saturday {
+		return ""
+	}
+	if _, ok := getSlotGrids().Timings[SaturdayTimingName]; ok {
+		return SaturdayTimingName
+	}
+	return ""
+}
+
+// ClassesForDayOrder lists the classes the timetable holds for a day order.
+func ClassesForDayOrder(timetable *types.TimetableResult, dayOrder int) []types.ScheduledClass {
+	classes := []types.ScheduledClass{}
+	if timetable == nil {
+		return classes
+	}
+
+	for _, day := range timetable.Schedule {
+		if day.Day != dayOrder {
+			continue
+		}
+		for _, cell := range day.Table {
+			if cell.Kind == types.CellKindFree || cell.Code == "" {
+				continue
+			}
+			class := types.ScheduledClass{
+				Code:       cell.Code,
+				Name:       cell.Name,
+				Slot:       strings.Join(cell.Slots, "-"),
+				RoomNo:     cell.RoomNo,
+				CourseType: cell.CourseType,
+				Online:     cell.Online,
+				Period:     cell.Period,
+				Span:       cell.Span,
+				StartTime:  cell.StartTime,
+				EndTime:    cell.EndTime,
+			}
+			if class.Slot == "" {
+				class.Slot = cell.Slot
+			}
+			if class.Span == 0 {
+				class.Span = 1
+			}
+			if class.StartTime == "" && class.Period >= 1 && class.Period+class.Span-1 <= len(timetable.Periods) {
+				class.StartTime = timetable.Periods[class.Period-1].Start
+				class.EndTime = timetable.Periods[class.Period+class.Span-2].End
+			}
+			classes = append(classes, class)
+		}
+	}
+	return classes
+}
+
+// CurrentAndNext finds the class in progress at now and the one after it.
+func CurrentAndNext(classes []types.ScheduledClass, now time.Time) (*types.ScheduledClass, *types.ScheduledClass) {
+	clock := now.In(PlannerLocation).Format("15:04")
+
+	var current, next *types.ScheduledClass
+	for i := range classes {
+		class := &classes[i]
+		if class.StartTime == "" {
+			continue
+		}
+		if class.StartTime <= clock && clock < class.EndTime {
+			current = class
+			continue
+		}
+		if class.StartTime > clock && next == nil {
+			next = class
+		}
+	}
+	return current, next
+}
@@ -0,0 +1,372 @@
+package helpers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"goscraper/src/types"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed data/slot_grids.json
+var defaultSlotGrids []byte
+
+const (
+	slotGridDayOrders  = 5
+	slotGridWildcard   = "*"
+	DefaultTimingName  = "default"
+	SaturdayTimingName = "saturday"
+)
+
+var (
+	slotGridsMu sync.RWMutex
+	slotGrids   *types.SlotGridConfig
+)
+
+// LoadSlotGrids reads the slot grids from SLOT_GRIDS_PATH, falling back to the
+// grids bundled with the binary. The active grids are only replaced when the
+// new config passes validation.
+func LoadSlotGrids() (*types.SlotGridConfig, error) {
+	raw := defaultSlotGrids
+	if path := os.Getenv("SLOT_GRIDS_PATH"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read slot grids: %v", err)
+		}
+		raw = data
+	}
+
+	config, err := parseSlotGrids(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	slotGridsMu.Lock()
+	slotGrids = config
+	slotGridsMu.Unlock()
+	return config, nil
+}
+
+func parseSlotGrids(raw []byte) (*types.SlotGridConfig, error) {
+	var config types.SlotGridConfig
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("invalid slot grids: %v", err)
+	}
+
+	for name, profile := range config.Timings {
+		for i := range profile.Periods {
+			profile.Periods[i].Period = i + 1
+		}
+		config.Timings[name] = profile
+	}
+
+	for i := range config.Grids {
+		grid := &config.Grids[i]
+		if grid.Timing == "" {
+			grid.Timing = DefaultTimingName
+		}
+		if grid.Program == "" {
+			grid.Program = slotGridWildcard
+		}
+		if grid.Campus == "" {
+			grid.Campus = slotGridWildcard
+		}
+		for j := range grid.Slots {
+			if grid.Slots[j].DayOrder == "" {
+				grid.Slots[j].DayOrder = fmt.Sprintf("Day %d", grid.Slots[j].Day)
+			}
+		}
+	}
+
+	if err := ValidateSlotGrids(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// ValidateSlotGrids checks that every grid covers the five day orders with the
+// same number of periods, only uses known slot codes and has a timing profile
+// with one entry per period.
+func ValidateSlotGrids(config *types.SlotGridConfig) error {
+	if config.Version == "" {
+		return fmt.Errorf("slot grids: missing version")
+	}
+	if len(config.Grids) == 0 {
+		return fmt.Errorf("slot grids: no grids defined")
+	}
+
+	for name, profile := range config.Timings {
+		if err := validateTimingProfile(profile); err != nil {
+			return fmt.Errorf("slot grids: timing %q: %v", name, err)
+		}
+	}
+
+	for i, group := range config.ParallelCourses {
+		if len(group) < 2 {
+			return fmt.Errorf("slot grids: parallel course group %d needs at least two codes", i)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, grid := range config.Grids {
+		name := fmt.Sprintf("grid %s/%s/batch %s", grid.Program, grid.Campus, grid.Batch)
+		if grid.Batch == "" {
+			return fmt.Errorf("slot grids: %s has no batch", name)
+		}
+
+		key := strings.ToLower(grid.Program + "|" + grid.Campus + "|" + grid.Batch)
+		if seen[key] {
+			return fmt.Errorf("slot grids: %s is defined more than once", name)
+		}
+		seen[key] = true
+
+		if len(grid.Slots) != slotGridDayOrders {
+			return fmt.Errorf("slot grids: %s has %d day orders, want %d", name, len(grid.Slots), slotGridDayOrders)
+		}
+
+		days := make(map[int]bool)
+		periods := len(grid.Slots[0].Slots)
+		if periods == 0 {
+			return fmt.Errorf("slot grids: %s has no periods", name)
+		}
+		for _, day := range grid.Slots {
+			if day.Day < 1 || day.Day > slotGridDayOrders || days[day.Day] {
+				return fmt.Errorf("slot grids: %s has invalid or duplicate day order %d", name, day.Day)
+			}
+			days[day.Day] = true
+
+			if len(day.Slots) != periods {
+				return fmt.Errorf("slot grids: %s day %d has %d periods, want %d", name, day.Day, len(day.Slots), periods)
+			}
+			for _, slot := range day.Slots {
+				if !isKnownSlotCode(config, slot) {
+					return fmt.Errorf("slot grids: %s day %d has unknown slot code %q", name, day.Day, slot)
+				}
+			}
+		}
+
+		profile, ok := config.Timings[grid.Timing]
+		if !ok {
+			return fmt.Errorf("slot grids: %s uses unknown timing %q", name, grid.Timing)
+		}
+		if len(profile.Periods) != periods {
+			return fmt.Errorf("slot grids: %s has %d periods but timing %q has %d", name, periods, grid.Timing, len(profile.Periods))
+		}
+	}
+
+	return nil
+}
+
+func validateTimingProfile(profile types.TimingProfile) error {
+	if len(profile.Periods) == 0 {
+		return fmt.Errorf("no periods")
+	}
+
+	var previousEnd time.Time
+	for i, period := range profile.Periods {
+		start, err := parseClock(period.Start)
+		if err != nil {
+			return fmt.Errorf("period %d has invalid start %q", period.Period, period.Start)
+		}
+		end, err := parseClock(period.End)
+		if err != nil {
+			return fmt.Errorf("period %d has invalid end %q", period.Period, period.End)
+		}
+		if !end.After(start) {
+			return fmt.Errorf("period %d ends before it starts", period.Period)
+		}
+		if i > 0 && start.Before(previousEnd) {
+			return fmt.Errorf("period %d overlaps the previous period", period.Period)
+		}
+		previousEnd = end
+	}
+
+	for _, b := range profile.Breaks {
+		start, err := parseClock(b.Start)
+		if err != nil {
+			return fmt.Errorf("break %q has invalid start %q", b.Name, b.Start)
+		}
+		end, err := parseClock(b.End)
+		if err != nil || !end.After(start) {
+			return fmt.Errorf("break %q has invalid end %q", b.Name, b.End)
+		}
+	}
+
+	return nil
+}
+
+// parseClock parses a time of day written as zero-padded "HH:MM", the only
+// form the schedule and iCalendar export can use as is.
+func parseClock(value string) (time.Time, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.Format("15:04") != value {
+		return time.Time{}, fmt.Errorf("time %q is not zero-padded HH:MM", value)
+	}
+	return t, nil
+}
+
+func isKnownSlotCode(config *types.SlotGridConfig, slot string) bool {
+	for _, code := range config.SlotCodes {
+		if slot == code {
+			return true
+		}
+	}
+	if config.PracticalPrefix != "" && strings.HasPrefix(slot, config.PracticalPrefix) {
+		n, err := strconv.Atoi(strings.TrimPrefix(slot, config.PracticalPrefix))
+		return err == nil && n > 0
+	}
+	return false
+}
+
+func getSlotGrids() *types.SlotGridConfig {
+	slotGridsMu.RLock()
+	config := slotGrids
+	slotGridsMu.RUnlock()
+	if config != nil {
+		return config
+	}
+
+	config, err := LoadSlotGrids()
+	if err != nil {
+		log.Printf("Falling back to bundled slot grids: %v", err)
+		config, _ = parseSlotGrids(defaultSlotGrids)
+		slotGridsMu.Lock()
+		slotGrids = config
+		slotGridsMu.Unlock()
+	}
+	return config
+}
+
+// SlotGrids returns every configured grid.
+func SlotGrids() []types.Batch {
+	return getSlotGrids().Grids
+}
+
+func SlotGridVersion() string {
+	return getSlotGrids().Version
+}
+
+// SlotGrid finds the grid for a batch, preferring an exact program and campus
+// match over wildcard grids.
+func SlotGrid(program string, campus string, batch string) (types.Batch, error) {
+	var best types.Batch
+	bestScore := -1
+
+	matches := func(pattern string, value string) (bool, int) {
+		if strings.EqualFold(pattern, strings.TrimSpace(value)) && value != "" {
+			return true, 1
+		}
+		return pattern == slotGridWildcard, 0
+	}
+
+	for _, grid := range getSlotGrids().Grids {
+		if grid.Batch != strings.TrimSpace(batch) {
+			continue
+		}
+		programOk, programScore := matches(grid.Program, program)
+		campusOk, campusScore := matches(grid.Campus, campus)
+		if !programOk || !campusOk {
+			continue
+		}
+		if score := programScore*2 + campusScore; score > bestScore {
+			best = grid
+			bestScore = score
+		}
+	}
+
+	if bestScore < 0 {
+		return types.Batch{}, fmt.Errorf("invalid batch number: %s", batch)
+	}
+	return best, nil
+}
+
+// StudentCampus returns the campus on the student's profile, falling back to
+// the deployment's CAMPUS when the profile doesn't name one.
+func StudentCampus(user *types.User) string {
+	if user != nil && strings.TrimSpace(user.Campus) != "" {
+		return strings.TrimSpace(user.Campus)
+	}
+	return os.Getenv("CAMPUS")
+}
+
+// SlotGridsFor returns the best matching grid for every batch available to a
+// program and campus.
+func SlotGridsFor(program string, campus string) []types.Batch {
+	var grids []types.Batch
+	seen := make(map[string]bool)
+	for _, grid := range getSlotGrids().Grids {
+		if seen[grid.Batch] {
+			continue
+		}
+		seen[grid.Batch] = true
+		if best, err := SlotGrid(program, campus, grid.Batch); err == nil {
+			grids = append(grids, best)
+		}
+	}
+	return grids
+}
+
+// TimingFor returns the named timing profile for a grid, or the grid's own
+// profile when name is empty. The profile must have one period per grid column.
+func TimingFor(grid types.Batch, name string) (string, types.TimingProfile, error) {
+	if name == "" {
+		name = grid.Timing
+	}
+	if name == "" {
+		name = DefaultTimingName
+	}
+
+	profile, ok := getSlotGrids().Timings[name]
+	if !ok {
+		return "", types.TimingProfile{}, fmt.Errorf("unknown timing profile: %s", name)
+	}
+	if len(grid.Slots) > 0 && len(profile.Periods) != len(grid.Slots[0].Slots) {
+		return "", types.TimingProfile{}, fmt.Errorf("timing profile %s doesn't fit batch %s", name, grid.Batch)
+	}
+	return name, profile, nil
+}
+
+// TimingProfileByName returns a configured timing profile.
+func TimingProfileByName(name string) (types.TimingProfile, bool) {
+	profile, ok := getSlotGrids().Timings[name]
+	return profile, ok
+}
+
+// AreParallelCourses reports whether the courses are known to legitimately
+// share a slot: they are the same course, or all belong to one configured
+// parallel course group.
+func AreParallelCourses(codes []string) bool {
+	unique := make(map[string]bool)
+	for _, code := range codes {
+		unique[strings.ToUpper(strings.TrimSpace(code))] = true
+	}
+	if len(unique) < 2 {
+		return true
+	}
+
+	for _, group := range getSlotGrids().ParallelCourses {
+		members := make(map[string]bool)
+		for _, code := range group {
+			members[strings.ToUpper(strings.TrimSpace(code))] = true
+		}
+		covered := true
+		for code := range unique {
+			if !members[code] {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
@@ -3,33 +3,10 @@ package helpers
 import (
 	"fmt"
 	"goscraper/src/types"
-
+	"sort"
 	"strings"
 )
 
-var batch1 = types.Batch{
-	Batch: "1",
-	Slots: []types.Slot{
-		{Day: 1, DayOrder: "Day 1", Slots: []string{"P1", "P2", "P3", "P4", "P5", "A", "A", "F", "F", "G"}},
-		{Day: 2, DayOrder: "Day 2", Slots: []string{"B", "B", "G", "G", "A", "P16", "P17", "P18", "P19", "P20"}},
-		{Day: 3, DayOrder: "Day 3", Slots: []string{"P21", "P22", "P23", "P24", "P25", "C", "C", "A", "D", "B"}},
-		{Day: 4, DayOrder: "Day 4", Slots: []string{"D", "D", "B", "E", "C", "P36", "P37", "P38", "P39", "P40"}},
-		{Day: 5, DayOrder: "Day 5", Slots: []string{"P41", "P42", "P43", "P44", "P45", "E", "E", "C", "F", "D"}},
-	},
-}
-
-// I put the "Batch 1" data (Morning Theory) here into "batch2"
-var batch2 = types.Batch{
-	Batch: "2",
-	Slots: []types.Slot{
-		{Day: 1, DayOrder: "Day 1", Slots: []string{"A", "A", "F", "F", "G", "P6", "P7", "P8", "P9", "P10"}},
-		{Day: 2, DayOrder: "Day 2", Slots: []string{"P11", "P12", "P13", "P14", "P15", "B", "B", "G", "G", "A"}},
-		{Day: 3, DayOrder: "Day 3", Slots: []string{"C", "C", "A", "D", "B", "P26", "P27", "P28", "P29", "P30"}},
-		{Day: 4, DayOrder: "Day 4", Slots: []string{"P31", "P32", "P33", "P34", "P35", "D", "D", "B", "E", "C"}},
-		{Day: 5, DayOrder: "Day 5", Slots: []string{"E", "E", "C", "F", "D", "P46", "P47", "P48", "P49", "P50"}},
-	},
-}
-
 type Timetable struct {
 	cookie string
 }
@@ -38,31 +15,39 @@ func NewTimetable(cookie string) *Timetable {
 	return &Timetable{cookie: cookie}
 }
 
-func (t *Timetable) GetTimetable(batchNumber int) (*types.TimetableResult, error) {
+func (t *Timetable) GetTimetable(program string, campus string, batch string, timing string) (*types.TimetableResult, error) {
 	coursePage := NewCoursePage(t.cookie)
 	courseList, err := coursePage.GetCourses()
 	if err != nil {
 		return nil, err
 	}
 
-	// Select the batch based on the input parameter
-	var selectedBatch types.Batch
-	switch batchNumber {
-	case 1:
-		selectedBatch = batch1
-	case 2:
-		selectedBatch = batch2
-	default:
-		return nil, fmt.Errorf("invalid batch number: %d", batchNumber)
+	// Pick the slot grid that best fits the registered slots, falling back to
+	// the batch on the student's profile when that's ambiguous
+	resolution := InferBatch(courseList.Courses, SlotGridsFor(program, campus), batch)
+	selectedBatch, err := SlotGrid(program, campus, resolution.Batch)
+	if err != nil {
+		return nil, err
+	}
+
+	timingName, profile, err := TimingFor(selectedBatch, timing)
+	if err != nil {
+		return nil, err
 	}
 
 	// Map the slots for the selected batch
-	mappedSchedule := t.mapSlotsToSubjects(selectedBatch, courseList.Courses)
+	mappedSchedule, conflicts := t.mapSlotsToSubjects(selectedBatch, profile, courseList.Courses)
 
 	return &types.TimetableResult{
-		RegNumber: courseList.RegNumber,
-		Batch:     selectedBatch.Batch,
-		Schedule:  mappedSchedule,
+		RegNumber:   courseList.RegNumber,
+		Batch:       selectedBatch.Batch,
+		Resolution:  &resolution,
+		GridVersion: SlotGridVersion(),
+		Timing:      timingName,
+		Periods:     profile.Periods,
+		Breaks:      profile.Breaks,
+		Schedule:    mappedSchedule,
+		Conflicts:   conflicts,
 	}, nil
 }
 
@@ -70,7 +55,12 @@ func (t *Timetable) getSlotsFromRange(slotRange string) []string {
 	return strings.Split(slotRange, "-")
 }
 
-func (t *Timetable) mapSlotsToSubjects(batch types.Batch, subjects []types.Course) []types.DaySchedule {
+// mapSlotsToSubjects lays the courses out on the grid as typed cells.
+// Consecutive periods of the same practical course become one lab block.
+// Courses sharing a slot are merged into one cell: known parallel courses,
+// or courses that are all optional by category, become an elective choice,
+// anything else is flagged and reported as a conflict.
+func (t *Timetable) mapSlotsToSubjects(batch types.Batch, timing types.TimingProfile, subjects []types.Course) ([]types.DaySchedule, []types.SlotConflict) {
 
 	slotMapping := make(map[string][]types.TableSlot)
 
@@ -96,38 +86,106 @@ func (t *Timetable) mapSlotsToSubjects(batch types.Batch, subjects []types.Cours
 				CourseType: slotType,
 				RoomNo:     subject.Room,
 				Slot:       slot,
+				IsOptional: isOptionalCourse(subject),
 			}
 			slotMapping[slot] = append(slotMapping[slot], tableSlot)
 		}
 	}
 
+	clashes := make(map[string]bool)
+	for slot, slots := range slotMapping {
+		if len(slots) > 1 && !AreParallelCourses(uniqueCodes(slots)) && !allOptional(slots) {
+			clashes[slot] = true
+		}
+	}
+
 	var schedule []types.DaySchedule
+	conflictDays := make(map[string][]int)
 	for _, day := range batch.Slots {
-		var table []interface{}
-		for _, slot := range day.Slots {
-			if slots, ok := slotMapping[slot]; ok {
-				if len(slots) > 1 {
-					// Merge multiple courses for the same slot
-					merged := types.TableSlot{
-						Code:       strings.Join(uniqueCodes(slots), "/"),
-						Name:       strings.Join(uniqueNames(slots), "/"),
-						Online:     slots[0].Online,
-						CourseType: slots[0].CourseType,
-						RoomNo:     strings.Join(uniqueRooms(slots), "/"),
-						Slot:       slot,
+		table := []types.TimetableCell{}
+		for i, slot := range day.Slots {
+			period := types.TableSlot{Slot: slot, Period: i + 1}
+			if i < len(timing.Periods) {
+				period.StartTime = timing.Periods[i].Start
+				period.EndTime = timing.Periods[i].End
+			}
+
+			slots, ok := slotMapping[slot]
+			if !ok {
+				table = append(table, types.TimetableCell{
+					Kind:      types.CellKindFree,
+					TableSlot: period,
+					Span:      1,
+					Slots:     []string{slot},
+				})
+				continue
+			}
+
+			cell := types.TimetableCell{
+				Kind:  types.CellKindClass,
+				Span:  1,
+				Slots: []string{slot},
+			}
+			if codes := uniqueCodes(slots); len(codes) > 1 {
+				// Merge multiple courses for the same slot
+				cell.TableSlot = types.TableSlot{
+					Code:       strings.Join(codes, "/"),
+					Name:       strings.Join(uniqueNames(slots), "/"),
+					Online:     slots[0].Online,
+					CourseType: slots[0].CourseType,
+					RoomNo:     strings.Join(uniqueRooms(slots), "/"),
+					IsOptional: allOptional(slots),
+				}
+				cell.Options = uniqueCourses(slots)
+				if clashes[slot] {
+					cell.Conflict = true
+					if days := conflictDays[slot]; len(days) == 0 || days[len(days)-1] != day.Day {
+						conflictDays[slot] = append(days, day.Day)
 					}
-					table = append(table, merged)
 				} else {
-					table = append(table, slots[0])
+					cell.Kind = types.CellKindElective
 				}
 			} else {
-				table = append(table, nil)
+				cell.TableSlot = slots[0]
+				if isPracticalSlot(slot) {
+					cell.Kind = types.CellKindLab
+				}
+			}
+			cell.Slot = slot
+			cell.Period = period.Period
+			cell.StartTime = period.StartTime
+			cell.EndTime = period.EndTime
+
+			if n := len(table); n > 0 && cell.Kind == types.CellKindLab {
+				last := &table[n-1]
+				if last.Kind == types.CellKindLab && last.Code == cell.Code && last.Period+last.Span == cell.Period {
+					last.Span++
+					last.Slots = append(last.Slots, slot)
+					last.EndTime = cell.EndTime
+					continue
+				}
 			}
+			table = append(table, cell)
 		}
 		schedule = append(schedule, types.DaySchedule{Day: day.Day, Table: table})
 	}
 
-	return schedule
+	var conflicts []types.SlotConflict
+	for slot, days := range conflictDays {
+		codes := uniqueCodes(slotMapping[slot])
+		conflicts = append(conflicts, types.SlotConflict{
+			Slot:      slot,
+			DayOrders: days,
+			Codes:     codes,
+			Names:     uniqueNames(slotMapping[slot]),
+			Message:   fmt.Sprintf("Courses %s clash in slot %s", strings.Join(codes, ", "), slot),
+		})
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Slot < conflicts[j].Slot
+	})
+
+	return schedule, conflicts
 }
 
 func uniqueCodes(slots []types.TableSlot) []string {
@@ -166,66 +224,65 @@ func uniqueRooms(slots []types.TableSlot) []string {
 	return result
 }
 
-func (t *Timetable) mapWithFallback(subjects types.CourseResponse) *types.TimetableResult {
-	batches := []types.Batch{batch1, batch2}
-
-	for _, batch := range batches {
-		// First, check if this batch has any practical slots
-		hasPracticals := false
-		for _, daySlot := range batch.Slots {
-			for _, slot := range daySlot.Slots {
-				if strings.HasPrefix(slot, "P") {
-					hasPracticals = true
-					break
-				}
-			}
-			if hasPracticals {
-				break
-			}
+func uniqueCourses(slots []types.TableSlot) []types.TableSlot {
+	seen := make(map[string]bool)
+	var result []types.TableSlot
+	for _, slot := range slots {
+		if !seen[slot.Code] {
+			seen[slot.Code] = true
+			result = append(result, slot)
 		}
+	}
+	return result
+}
 
-		// Skip this batch if it has no practicals but courses have practical slots
-		hasPracticalCourses := false
-		for _, course := range subjects.Courses {
-			if strings.HasPrefix(course.Slot, "P") {
-				hasPracticalCourses = true
-				break
-			}
+func allOptional(slots []types.TableSlot) bool {
+	for _, slot := range slots {
+		if !slot.IsOptional {
+			return false
 		}
-		if hasPracticalCourses && !hasPracticals {
-			continue
+	}
+	return len(slots) > 0
+}
+
+// isOptionalCourse marks open electives and optional courses, which students
+// pick rather than being assigned.
+func isOptionalCourse(course types.Course) bool {
+	for _, category := range []string{course.Category, course.CourseCategory} {
+		category = strings.ToLower(category)
+		if strings.Contains(category, "open elective") || strings.Contains(category, "optional") {
+			return true
 		}
+	}
+	return false
+}
 
-		mappedSchedule := t.mapSlotsToSubjects(batch, subjects.Courses)
+func isPracticalSlot(slot string) bool {
+	prefix := getSlotGrids().PracticalPrefix
+	return prefix != "" && strings.HasPrefix(slot, prefix)
+}
 
-		// Rest of the existing slot matching logic
-		for _, course := range subjects.Courses {
-			if !strings.HasPrefix(course.Slot, "P") {
-				continue
+// NormalizeTimetable fills in cell kinds and spans for timetables cached
+// before cells were typed, where free periods were stored as null.
+func NormalizeTimetable(timetable *types.TimetableResult) {
+	if timetable == nil {
+		return
+	}
+	for i := range timetable.Schedule {
+		for j := range timetable.Schedule[i].Table {
+			cell := &timetable.Schedule[i].Table[j]
+			if cell.Kind == "" {
+				cell.Kind = types.CellKindClass
+				if cell.Code == "" {
+					cell.Kind = types.CellKindFree
+				}
 			}
-
-			var courseSlots []string
-			if strings.Contains(course.Slot, "-") {
-				courseSlots = t.getSlotsFromRange(course.Slot)
-			} else {
-				courseSlots = []string{course.Slot}
+			if cell.Span == 0 {
+				cell.Span = 1
 			}
-
-			for _, courseSlot := range courseSlots {
-				for _, daySlot := range batch.Slots {
-					for _, slot := range daySlot.Slots {
-						if courseSlot == slot {
-							return &types.TimetableResult{
-								RegNumber: subjects.RegNumber,
-								Batch:     batch.Batch,
-								Schedule:  mappedSchedule,
-							}
-						}
-					}
-				}
+			if cell.Period == 0 {
+				cell.Period = j + 1
 			}
 		}
 	}
-
-	return nil
 }
@@ -46,6 +46,8 @@ func GetUser(rawPage string) (*types.User, error) {
 				data.Program = value
 			case "Batch":
 				data.Batch = value
+			case "Campus":
+				data.Campus = strings.TrimSpace(value)
 			case "Mobile":
 				data.Mobile = value
 			case "Semester":
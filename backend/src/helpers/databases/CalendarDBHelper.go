@@ -1,15 +1,14 @@
 package databases
 
 import (
-	"goscraper/src/globals"
+	"fmt"
 	"goscraper/src/helpers"
 	"goscraper/src/types"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/joho/godotenv"
-	"github.com/supabase-community/supabase-go"
+	"github.com/supabase-community/postgrest-go"
 )
 
 type DBResponse struct {
@@ -20,52 +19,172 @@ type DBResponse struct {
 	ID        int64  `json:"id"`
 	Month     string `json:"month"`
 	Order     string `json:"order"`
+	Term      string `json:"term"`
 }
-type CalendarDatabaseHelper struct {
-	client *supabase.Client
+type CalendarEvent struct {
+	ID        string `json:"id,omitempty"`
+	Term      string `json:"term"`
+	Date      string `json:"date"`
+	Day       string `json:"day"`
+	Month     string `json:"month"`
+	Order     string `json:"order"`
+	Event     string `json:"event"`
+	CreatedAt int64  `json:"created_at"`
 }
 
-func NewCalDBHelper() (*CalendarDatabaseHelper, error) {
-	if globals.DevMode {
-		godotenv.Load()
+type calendarTerm struct {
+	Term      string `json:"term"`
+	Hash      string `json:"hash"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type calendarChangeRow struct {
+	Term      string     `json:"term"`
+	Month     string     `json:"month"`
+	Date      string     `json:"date"`
+	Change    string     `json:"change"`
+	Before    *types.Day `json:"before"`
+	After     *types.Day `json:"after"`
+	ChangedAt int64      `json:"changed_at"`
+}
+
+// CalendarEvents flattens a scraped planner into the rows stored for a term,
+// keeping the first of any day listed twice.
+func CalendarEvents(term string, calendar *types.CalendarResponse) []CalendarEvent {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	seen := make(map[[2]string]bool)
+	var events []CalendarEvent
+	for _, month := range calendar.Calendar {
+		for _, day := range month.Days {
+			// A day listed twice would break the (term, month, date) key
+			key := [2]string{strings.TrimSpace(month.Month), strings.TrimSpace(day.Date)}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			events = append(events, CalendarEvent{
+				Term:      term,
+				Date:      day.Date,
+				Month:     month.Month,
+				Day:       day.Day,
+				Order:     day.DayOrder,
+				Event:     day.Event,
+				CreatedAt: now,
+			})
+		}
 	}
-	supabaseUrl := os.Getenv("SUPABASE_URL")
-	supabaseKey := os.Getenv("SUPABASE_KEY")
+	return events
+}
 
-	client, err := supabase.NewClient(supabaseUrl, supabaseKey, nil)
+// GetCalendarEvents returns a term's planner days and the hash they were
+// stored under. The hash is read first, so a replace racing the read makes
+// the next ReplaceCalendarEvents fail rather than pass on stale days.
+func (db *DatabaseHelper) GetCalendarEvents(term string) ([]CalendarEvent, string, error) {
+	var terms []calendarTerm
+	_, err := db.client.From("gocal_term").Select("*", "", false).Eq("term", term).ExecuteTo(&terms)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return &CalendarDatabaseHelper{
-		client: client,
-	}, nil
-}
+	var rows []DBResponse
+	_, err = db.client.From("gocal").Select("*", "", false).Eq("term", term).ExecuteTo(&rows)
+	if err != nil {
+		return nil, "", err
+	}
 
-type CalendarEvent struct {
-	ID        string `json:"id"`
-	Date      string `json:"date"`
-	Day       string `json:"day"`
-	Month     string `json:"month"`
-	Order     string `json:"order"`
-	Event     string `json:"event"`
-	CreatedAt int64  `json:"created_at"`
+	events := make([]CalendarEvent, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, CalendarEvent{
+			ID:        strconv.FormatInt(row.ID, 10),
+			Term:      row.Term,
+			Date:      row.Date,
+			Day:       row.Day,
+			Month:     row.Month,
+			Order:     row.Order,
+			Event:     row.Event,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+
+	hash := ""
+	if len(terms) > 0 {
+		hash = terms[0].Hash
+	}
+	return events, hash, nil
 }
 
-func (h *CalendarDatabaseHelper) SetEvent(event CalendarEvent) error {
-	_, _, err := h.client.From("gocal").Insert(event, false, "", "", "").Execute()
-	return err
+// ReplaceCalendarEvents swaps a term's planner days and records the changes in
+// one transaction through the replace_calendar function. It returns false
+// without writing when the stored hash is no longer previousHash.
+func (db *DatabaseHelper) ReplaceCalendarEvents(term string, previousHash string, hash string, events []CalendarEvent, changes []types.CalendarChange) (bool, error) {
+	rows := make([]calendarChangeRow, 0, len(changes))
+	for _, change := range changes {
+		rows = append(rows, calendarChangeRow{
+			Term:      term,
+			Month:     change.Month,
+			Date:      change.Date,
+			Change:    change.Change,
+			Before:    change.Before,
+			After:     change.After,
+			ChangedAt: change.ChangedAt,
+		})
+	}
+	if events == nil {
+		events = []CalendarEvent{}
+	}
+
+	result := strings.TrimSpace(db.client.Rpc("replace_calendar", "", map[string]interface{}{
+		"p_term":          term,
+		"p_previous_hash": previousHash,
+		"p_hash":          hash,
+		"p_events":        events,
+		"p_changes":       rows,
+	}))
+	switch result {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("replace_calendar: %s", result)
 }
 
-func (h *CalendarDatabaseHelper) GetEvents() (types.CalendarResponse, error) {
-	var events []DBResponse
-	_, err := h.client.From("gocal").Select("*", "", false).ExecuteTo(&events)
+// GetCalendarChanges returns a term's most recent planner changes, newest
+// first.
+func (db *DatabaseHelper) GetCalendarChanges(term string, limit int) ([]types.CalendarChange, error) {
+	var rows []calendarChangeRow
+	_, err := db.client.From("gocal_changes").Select("*", "", false).
+		Eq("term", term).
+		Order("changed_at", &postgrest.OrderOpts{Ascending: false}).
+		Limit(limit, "").
+		ExecuteTo(&rows)
 	if err != nil {
-		return types.CalendarResponse{}, err
+		return nil, err
 	}
+	return calendarChanges(rows), nil
+}
+
+func calendarChanges(rows []calendarChangeRow) []types.CalendarChange {
+	changes := make([]types.CalendarChange, 0, len(rows))
+	for _, row := range rows {
+		changes = append(changes, types.CalendarChange{
+			Term:      row.Term,
+			Month:     row.Month,
+			Date:      row.Date,
+			Change:    row.Change,
+			Before:    row.Before,
+			After:     row.After,
+			ChangedAt: row.ChangedAt,
+		})
+	}
+	return changes
+}
 
+// CalendarFromEvents groups stored planner days into months and picks out
+// today and tomorrow.
+func CalendarFromEvents(events []CalendarEvent) types.CalendarResponse {
 	if len(events) == 0 {
-		return types.CalendarResponse{}, nil
+		return types.CalendarResponse{}
 	}
 
 	var response []types.CalendarMonth = make([]types.CalendarMonth, 0)
@@ -144,5 +263,5 @@ func (h *CalendarDatabaseHelper) GetEvents() (types.CalendarResponse, error) {
 		Message:  "From DB",
 	}
 
-	return resp, nil
+	return resp
 }
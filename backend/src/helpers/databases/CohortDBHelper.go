@@ -0,0 +1,61 @@
+package databases
+
+import (
+	"encoding/json"
+	"goscraper/src/types"
+	"time"
+)
+
+// CohortRow is the part of a cached student row the cohort aggregation reads.
+type CohortRow struct {
+	RegNumber  string
+	User       *types.User
+	Attendance *types.AttendanceResponse
+	Marks      *types.MarksResponse
+}
+
+// decodeCached opens and unmarshals a cached section column, leaving target
+// nil when the column is empty or unreadable.
+func (db *studentCache) decodeCached(column string, value interface{}, target interface{}) {
+	if str, ok := value.(string); ok && str != "" {
+		if data, _, err := db.openSection(column, str); err == nil {
+			json.Unmarshal(data, target)
+		}
+	}
+}
+
+type cohortOptOut struct {
+	RegNumber string `json:"regNumber"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// SetCohortOptOut excludes or re-includes a student in cohort statistics.
+func (db *DatabaseHelper) SetCohortOptOut(regNumber string, optOut bool) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	if !optOut {
+		_, _, err := db.client.From("gocohort_optout").Delete("", "").Eq("regNumber", regNumber).Execute()
+		return err
+	}
+
+	row := cohortOptOut{
+		RegNumber: regNumber,
+		CreatedAt: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	_, _, err := db.client.From("gocohort_optout").Upsert(row, "regNumber", "", "").Execute()
+	return err
+}
+
+// GetCohortOptOuts returns the registration numbers of students who opted out.
+func (db *DatabaseHelper) GetCohortOptOuts() (map[string]bool, error) {
+	var rows []cohortOptOut
+	_, err := db.client.From("gocohort_optout").Select("*", "", false).ExecuteTo(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	optOuts := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		optOuts[NormalizeRegNumber(row.RegNumber)] = true
+	}
+	return optOuts, nil
+}
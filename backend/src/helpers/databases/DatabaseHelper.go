@@ -1,172 +1,41 @@
 package databases
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
-	"goscraper/src/globals"
-	"io"
 	"os"
-	"time"
+	"strconv"
+	"strings"
 
-	"github.com/joho/godotenv"
+	"github.com/supabase-community/postgrest-go"
 	"github.com/supabase-community/supabase-go"
 )
 
+// DatabaseHelper is the Supabase store.
 type DatabaseHelper struct {
-	client *supabase.Client
-	key    []byte
+	studentCache
+	client   *supabase.Client
+	sessions sessionCache
 }
 
 func NewDatabaseHelper() (*DatabaseHelper, error) {
-	if globals.DevMode {
-		godotenv.Load()
-	}
 	supabaseUrl := os.Getenv("SUPABASE_URL")
 	supabaseKey := os.Getenv("SUPABASE_KEY")
-	encryptionKey := os.Getenv("ENCRYPTION_KEY")
 
 	client, err := supabase.NewClient(supabaseUrl, supabaseKey, nil)
 	if err != nil {
 		return nil, err
 	}
-	hash := sha256.Sum256([]byte(encryptionKey))
-	return &DatabaseHelper{
-		client: client,
-		key:    hash[:],
-	}, nil
-}
-
-func (db *DatabaseHelper) encrypt(text string) (string, error) {
-	block, err := aes.NewCipher(db.key)
-	if err != nil {
-		return "", err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
-	}
-
-	ciphertext := gcm.Seal(nonce, nonce, []byte(text), nil)
-	encrypted := base64.StdEncoding.EncodeToString(ciphertext)
-	return encrypted, nil
-}
-
-func (db *DatabaseHelper) decrypt(encryptedText string) (string, error) {
-	ciphertext, err := base64.StdEncoding.DecodeString(encryptedText)
-	if err != nil {
-		return "", err
-	}
-
-	block, err := aes.NewCipher(db.key)
-	if err != nil {
-		return "", err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return "", err
-	}
-
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return "", err
-	}
-
-	return string(plaintext), nil
-}
-
-func (db *DatabaseHelper) UpsertData(table string, data map[string]interface{}) error {
-	regNumber, hasRegNumber := data["regNumber"]
-	token, hasToken := data["token"]
-
-	data["lastUpdated"] = time.Now().UnixNano() / int64(time.Millisecond)
-
-	for key, value := range data {
-		if key != "regNumber" && key != "token" && key != "lastUpdated" && key != "timetable" && key != "ophour" {
-			jsonBytes, err := json.Marshal(value)
-			if err != nil {
-				return err
-			}
-			// Encryption disabled per user request
-			// encrypted, err := db.encrypt(string(jsonBytes))
-			// if err != nil {
-			// 	return err
-			// }
-			// data[key] = encrypted
-			data[key] = string(jsonBytes)
-		}
-
-	}
-
-	if hasRegNumber {
-		data["regNumber"] = regNumber
-	}
-	if hasToken {
-		data["token"] = token
-	}
-
-	_, _, err := db.client.From(table).Upsert(data, "regNumber", "", "").Execute()
-	return err
-}
-
-func (db *DatabaseHelper) ReadData(table string, query map[string]interface{}) ([]map[string]interface{}, error) {
-	var results []map[string]interface{}
-
-	queryAsString := make(map[string]string)
-	for k, v := range query {
-		if str, ok := v.(string); ok {
-			queryAsString[k] = str
-		}
-	}
-
-	_, _, err := db.client.From(table).Select("*", "", false).Match(queryAsString).Execute()
-	if err != nil {
-		return nil, err
-	}
 
-	for _, row := range results {
-		for key, value := range row {
-			if str, ok := value.(string); ok {
-				if key != "regNumber" && key != "token" && key != "lastUpdated" && key != "timetable" && key != "ophour" {
-					// Decryption disabled - assuming plaintext
-					// decrypted, err := db.decrypt(str)
-					// if err != nil {
-					// 	return nil, err
-					// }
-					// row[key] = decrypted
-					row[key] = str
-				}
-			}
-		}
+	db := &DatabaseHelper{
+		client: client,
 	}
-
-	return results, nil
+	db.studentCache = newStudentCache(db)
+	return db, nil
 }
 
-func (db *DatabaseHelper) FindByToken(table string, token string) (map[string]interface{}, error) {
+func (db *DatabaseHelper) findStudent(column string, value string, columns string) (map[string]interface{}, error) {
 	var results []map[string]interface{}
 
-	query := map[string]string{
-		"token": token,
-	}
-
-	_, err := db.client.From(table).Select("*", "", false).Match(query).ExecuteTo(&results)
+	_, err := db.client.From("goscrape").Select(columns, "", false).Eq(column, value).ExecuteTo(&results)
 	if err != nil {
 		return nil, err
 	}
@@ -174,119 +43,56 @@ func (db *DatabaseHelper) FindByToken(table string, token string) (map[string]in
 	if len(results) == 0 {
 		return nil, nil
 	}
-
-	for key, value := range results[0] {
-		if str, ok := value.(string); ok {
-			if key == "timetable" {
-				var jsonData interface{}
-				if err := json.Unmarshal([]byte(str), &jsonData); err != nil {
-					return nil, err
-				}
-				results[0][key] = jsonData
-			} else if key != "regNumber" && key != "token" && key != "lastUpdated" && key != "timetable" && key != "ophour" {
-				// Decryption disabled - assuming plaintext
-				// decrypted, err := db.decrypt(str)
-				// if err != nil {
-				// 	return nil, err
-				// }
-				var jsonData interface{}
-				// if err := json.Unmarshal([]byte(decrypted), &jsonData); err != nil {
-				if err := json.Unmarshal([]byte(str), &jsonData); err != nil {
-					return nil, err
-				}
-				results[0][key] = jsonData
-			}
-		}
-	}
-
 	return results[0], nil
 }
 
-func (db *DatabaseHelper) GetOphourByToken(token string) (string, error) {
-	var results []map[string]interface{}
-
-	query := map[string]string{
-		"token": token,
-	}
-
-	_, err := db.client.From("goscrape").Select("ophour", "", false).Match(query).ExecuteTo(&results)
+func (db *DatabaseHelper) insertStudent(row map[string]interface{}) (bool, error) {
+	_, _, err := db.client.From("goscrape").Insert(row, false, "", "minimal", "").Execute()
 	if err != nil {
-		return "", err
-	}
-
-	if len(results) == 0 {
-		return "", nil
-	}
-
-	ophour, ok := results[0]["ophour"].(string)
-	if !ok {
-		return "", nil
+		// 23505 is Postgres' unique_violation: the row already exists.
+		if strings.HasPrefix(err.Error(), "(23505)") {
+			return false, nil
+		}
+		return false, err
 	}
-	return ophour, nil
+	return true, nil
 }
 
-// GetCachedDataByKey retrieves cached data by a specific key (e.g., "marks", "attendance")
-// Returns the data, whether it exists, whether it's fresh (< 1 hour), and any error
-func (db *DatabaseHelper) GetCachedDataByKey(token string, dataKey string) (interface{}, bool, bool, error) {
-	cachedData, err := db.FindByToken("goscrape", token)
+func (db *DatabaseHelper) updateStudent(regNumber string, revision int64, row map[string]interface{}) (bool, error) {
+	_, count, err := db.client.From("goscrape").
+		Update(row, "minimal", "exact").
+		Eq("regNumber", regNumber).
+		Eq("revision", strconv.FormatInt(revision, 10)).
+		Execute()
 	if err != nil {
-		return nil, false, false, err
-	}
-
-	if cachedData == nil || len(cachedData) == 0 {
-		return nil, false, false, nil
-	}
-
-	// Check if the requested key exists in cache
-	data, exists := cachedData[dataKey]
-	if !exists || data == nil {
-		return nil, false, false, nil
+		return false, err
 	}
+	return count > 0, nil
+}
 
-	// Check staleness (1 hour = 3600000 milliseconds)
-	lastUpdated, ok := cachedData["lastUpdated"]
-	if !ok {
-		return data, true, false, nil // Data exists but no timestamp, consider stale
-	}
+func (db *DatabaseHelper) deleteStudent(regNumber string) error {
+	_, _, err := db.client.From("goscrape").Delete("minimal", "").Eq("regNumber", regNumber).Execute()
+	return err
+}
 
-	var lastUpdatedMs int64
-	switch v := lastUpdated.(type) {
-	case int64:
-		lastUpdatedMs = v
-	case float64:
-		lastUpdatedMs = int64(v)
-	case int:
-		lastUpdatedMs = int64(v)
-	default:
-		return data, true, false, nil // Unknown type, consider stale
+func (db *DatabaseHelper) deleteBlankStudents(regNumber string) (int, error) {
+	_, count, err := db.client.From("goscrape").Delete("minimal", "exact").Eq("regNumber", regNumber).Execute()
+	if err != nil || regNumber != "" {
+		return int(count), err
 	}
-
-	currentTime := time.Now().UnixNano() / int64(time.Millisecond)
-	age := currentTime - lastUpdatedMs
-	isFresh := age < 3600000 // 1 hour in milliseconds
-
-	return data, true, isFresh, nil
+	_, nulls, err := db.client.From("goscrape").Delete("minimal", "exact").Is("regNumber", "null").Execute()
+	return int(count + nulls), err
 }
 
-// UpsertDataByKey updates a specific key in the cache
-func (db *DatabaseHelper) UpsertDataByKey(token string, regNumber string, dataKey string, data interface{}) error {
-	// First, get existing data to preserve other keys
-	existingData, err := db.FindByToken("goscrape", token)
+func (db *DatabaseHelper) studentPage(offset int, limit int, columns string) ([]map[string]interface{}, error) {
+	var page []map[string]interface{}
+	_, err := db.client.From("goscrape").
+		Select(columns, "", false).
+		Order("regNumber", &postgrest.OrderOpts{Ascending: true}).
+		Range(offset, offset+limit-1, "").
+		ExecuteTo(&page)
 	if err != nil {
-		// If no existing data, create new
-		existingData = make(map[string]interface{})
-	}
-
-	if existingData == nil {
-		existingData = make(map[string]interface{})
-	}
-
-	// Update the specific key
-	existingData[dataKey] = data
-	existingData["token"] = token
-	if regNumber != "" {
-		existingData["regNumber"] = regNumber
+		return nil, err
 	}
-
-	return db.UpsertData("goscrape", existingData)
-}
\ No newline at end of file
+	return page, nil
+}
@@ -0,0 +1,277 @@
+package databases
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Encrypted sections are stored as an envelope:
+//
+//	enc:v1:aes-256-gcm:<key id>:<base64 nonce+ciphertext>
+//
+// The key ID says which key sealed the value, so rows written under a retired
+// key can still be opened after ENCRYPTION_KEY is rotated.
+const (
+	envelopePrefix  = "enc"
+	envelopeVersion = "v1"
+	algAES256GCM    = "aes-256-gcm"
+)
+
+var errUnknownKey = errors.New("encrypted with an unknown key")
+
+type encryptionKey struct {
+	id  string
+	key []byte
+}
+
+func newEncryptionKey(secret string) *encryptionKey {
+	key := sha256.Sum256([]byte(secret))
+	id := sha256.Sum256(append([]byte("key-id:"), key[:]...))
+	return &encryptionKey{
+		id:  hex.EncodeToString(id[:4]),
+		key: key[:],
+	}
+}
+
+// keyRing holds the key new values are sealed with and every key values may
+// still be sealed with. A nil active key leaves new values in plaintext.
+type keyRing struct {
+	active *encryptionKey
+	keys   []*encryptionKey
+}
+
+// loadKeyRing reads ENCRYPTION_KEY, the active key, and
+// ENCRYPTION_PREVIOUS_KEYS, a comma separated list of retired keys that are
+// only used to open old values.
+func loadKeyRing() keyRing {
+	var ring keyRing
+	if secret := os.Getenv("ENCRYPTION_KEY"); secret != "" {
+		ring.active = newEncryptionKey(secret)
+		ring.keys = append(ring.keys, ring.active)
+	}
+	for _, secret := range strings.Split(os.Getenv("ENCRYPTION_PREVIOUS_KEYS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			ring.keys = append(ring.keys, newEncryptionKey(secret))
+		}
+	}
+	return ring
+}
+
+func (r keyRing) find(id string) *encryptionKey {
+	for _, key := range r.keys {
+		if key.id == id {
+			return key
+		}
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with the active key. column is bound as additional
+// data so a value can't be moved to another column. Without an active key the
+// plaintext is returned unchanged.
+func (r keyRing) seal(column string, plaintext string) (string, error) {
+	if r.active == nil {
+		return plaintext, nil
+	}
+
+	gcm, err := newGCM(r.active.key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(column))
+	return strings.Join([]string{
+		envelopePrefix,
+		envelopeVersion,
+		algAES256GCM,
+		r.active.id,
+		base64.StdEncoding.EncodeToString(ciphertext),
+	}, ":"), nil
+}
+
+// open returns the plaintext of a stored value: an envelope, a value sealed
+// before envelopes existed, or plaintext JSON.
+func (r keyRing) open(column string, stored string) (string, error) {
+	if strings.HasPrefix(stored, envelopePrefix+":") {
+		return r.openEnvelope(column, stored)
+	}
+	if json.Valid([]byte(stored)) {
+		return stored, nil
+	}
+	return r.openLegacy(stored)
+}
+
+func (r keyRing) openEnvelope(column string, stored string) (string, error) {
+	parts := strings.SplitN(stored, ":", 5)
+	if len(parts) != 5 {
+		return "", errors.New("malformed encryption envelope")
+	}
+	version, alg, id, payload := parts[1], parts[2], parts[3], parts[4]
+	if version != envelopeVersion {
+		return "", fmt.Errorf("unsupported envelope version: %s", version)
+	}
+	if alg != algAES256GCM {
+		return "", fmt.Errorf("unsupported encryption algorithm: %s", alg)
+	}
+
+	key := r.find(id)
+	if key == nil {
+		return "", fmt.Errorf("%w: %s", errUnknownKey, id)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key.key)
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(column))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// openLegacy opens a bare base64 nonce+ciphertext, the format used before
+// envelopes, trying every known key.
+func (r keyRing) openLegacy(stored string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return "", errors.New("stored value is neither JSON nor encrypted")
+	}
+
+	for _, key := range r.keys {
+		gcm, err := newGCM(key.key)
+		if err != nil {
+			return "", err
+		}
+		if len(ciphertext) < gcm.NonceSize() {
+			break
+		}
+		nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+		if plaintext, err := gcm.Open(nil, nonce, sealed, nil); err == nil {
+			return string(plaintext), nil
+		}
+	}
+	return "", errUnknownKey
+}
+
+// current reports whether a stored value is already in the form seal would
+// produce now: sealed with the active key, or plaintext when there is none.
+func (r keyRing) current(stored string) bool {
+	if r.active == nil {
+		return !strings.HasPrefix(stored, envelopePrefix+":") && json.Valid([]byte(stored))
+	}
+	prefix := strings.Join([]string{envelopePrefix, envelopeVersion, algAES256GCM, r.active.id}, ":") + ":"
+	return strings.HasPrefix(stored, prefix)
+}
+
+// ReencryptResult counts what a re-encryption pass did.
+type ReencryptResult struct {
+	Rows    int `json:"rows"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+}
+
+// Reencrypt seals every cached section, and every history and grade
+// payload, that is plaintext or sealed with a retired key under the active
+// key. Rows it can't open are counted and left alone, as are rows written to
+// while the pass runs; the next pass picks them up.
+func (db *studentCache) Reencrypt() (ReencryptResult, error) {
+	result, err := db.reencryptSections()
+	if err != nil {
+		return result, err
+	}
+	for _, table := range sealedTables {
+		if err := db.reencryptPayloads(table, &result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (db *studentCache) reencryptSections() (ReencryptResult, error) {
+	var result ReencryptResult
+	columns := "regNumber,revision," + strings.Join(sectionColumns, ",")
+
+	for offset := 0; ; offset += cohortPageSize {
+		page, err := db.rows.studentPage(offset, cohortPageSize, columns)
+		if err != nil {
+			return result, err
+		}
+
+		for _, row := range page {
+			result.Rows++
+			update := make(map[string]interface{})
+			failed := false
+			for _, column := range sectionColumns {
+				stored, ok := row[column].(string)
+				if !ok || stored == "" || db.keys.current(stored) {
+					continue
+				}
+				plaintext, err := db.keys.open(column, stored)
+				if err != nil {
+					failed = true
+					continue
+				}
+				sealed, err := db.keys.seal(column, plaintext)
+				if err != nil {
+					return result, err
+				}
+				update[column] = sealed
+			}
+
+			if failed {
+				result.Failed++
+			}
+			if len(update) == 0 {
+				continue
+			}
+
+			regNumber, _ := row["regNumber"].(string)
+			revision, _ := int64Value(row["revision"])
+			update["revision"] = revision + 1
+			updated, err := db.rows.updateStudent(regNumber, revision, update)
+			if err != nil {
+				return result, err
+			}
+			if updated {
+				result.Updated++
+			}
+		}
+
+		if len(page) < cohortPageSize {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package databases
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"goscraper/src/types"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func ringFor(t *testing.T, active string, previous string) keyRing {
+	t.Helper()
+	t.Setenv("ENCRYPTION_KEY", active)
+	t.Setenv("ENCRYPTION_PREVIOUS_KEYS", previous)
+	return loadKeyRing()
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	ring := ringFor(t, "current-key", "")
+	plaintext := `{"regNumber":"RA2311003010001"}`
+
+	sealed, err := ring.seal("attendance", plaintext)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if !strings.HasPrefix(sealed, "enc:v1:aes-256-gcm:"+ring.active.id+":") {
+		t.Fatalf("unexpected envelope: %s", sealed)
+	}
+	if strings.Contains(sealed, "RA2311003010001") {
+		t.Fatal("sealed value contains the plaintext")
+	}
+	if !ring.current(sealed) {
+		t.Error("value sealed with the active key isn't current")
+	}
+
+	opened, err := ring.open("attendance", sealed)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if opened != plaintext {
+		t.Errorf("opened %q, want %q", opened, plaintext)
+	}
+}
+
+func TestOpenWithPreviousKey(t *testing.T) {
+	sealed, err := ringFor(t, "old-key", "").seal("marks", `{"a":1}`)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	rotated := ringFor(t, "new-key", "unrelated, old-key")
+	opened, err := rotated.open("marks", sealed)
+	if err != nil {
+		t.Fatalf("open with previous key: %v", err)
+	}
+	if opened != `{"a":1}` {
+		t.Errorf("opened %q", opened)
+	}
+	if rotated.current(sealed) {
+		t.Error("value sealed with a previous key reported as current")
+	}
+
+	_, err = ringFor(t, "new-key", "").open("marks", sealed)
+	if !errors.Is(err, errUnknownKey) {
+		t.Errorf("open without the old key: got %v, want errUnknownKey", err)
+	}
+}
+
+func TestOpenRejectsOtherColumn(t *testing.T) {
+	ring := ringFor(t, "current-key", "")
+	sealed, err := ring.seal("marks", `{"a":1}`)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if _, err := ring.open("attendance", sealed); err == nil {
+		t.Error("value sealed for marks opened as attendance")
+	}
+}
+
+func TestOpenRejectsTamperedEnvelope(t *testing.T) {
+	ring := ringFor(t, "current-key", "")
+	sealed, err := ring.seal("marks", `{"a":1}`)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	i := strings.LastIndex(sealed, ":") + 1
+	payload, _ := base64.StdEncoding.DecodeString(sealed[i:])
+	payload[len(payload)-1] ^= 1
+	tampered := sealed[:i] + base64.StdEncoding.EncodeToString(payload)
+	if _, err := ring.open("marks", tampered); err == nil {
+		t.Error("tampered value opened")
+	}
+
+	for _, malformed := range []string{"enc:v1:aes-256-gcm", "enc:v2:aes-256-gcm:" + ring.active.id + ":AAAA", "enc:v1:rot13:" + ring.active.id + ":AAAA"} {
+		if _, err := ring.open("marks", malformed); err == nil {
+			t.Errorf("malformed envelope %q opened", malformed)
+		}
+	}
+}
+
+func TestOpenLegacyValues(t *testing.T) {
+	ring := ringFor(t, "new-key", "old-key")
+
+	plain := `{"a":1}`
+	opened, err := ring.open("marks", plain)
+	if err != nil || opened != plain {
+		t.Errorf("plaintext JSON: got %q, %v", opened, err)
+	}
+	if ring.current(plain) {
+		t.Error("plaintext reported as current with an active key")
+	}
+
+	// Values sealed before envelopes: bare base64 nonce+ciphertext, no
+	// additional data
+	gcm, err := newGCM(newEncryptionKey("old-key").key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		t.Fatal(err)
+	}
+	legacy := base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plain), nil))
+	opened, err = ring.open("marks", legacy)
+	if err != nil || opened != plain {
+		t.Errorf("legacy value: got %q, %v", opened, err)
+	}
+
+	if _, err := ring.open("marks", "not json or base64!"); err == nil {
+		t.Error("garbage opened")
+	}
+}
+
+func TestNoActiveKeyStoresPlaintext(t *testing.T) {
+	ring := ringFor(t, "", "")
+	sealed, err := ring.seal("marks", `{"a":1}`)
+	if err != nil || sealed != `{"a":1}` {
+		t.Errorf("got %q, %v", sealed, err)
+	}
+	if !ring.current(sealed) {
+		t.Error("plaintext isn't current without a key")
+	}
+}
+
+func sqliteWithKeys(t *testing.T, path string, active string, previous string) *SQLiteStore {
+	t.Helper()
+	t.Setenv("ENCRYPTION_KEY", active)
+	t.Setenv("ENCRYPTION_PREVIOUS_KEYS", previous)
+	db, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { db.db.Close() })
+	return db
+}
+
+func TestReencryptSealsHistoryAndGrades(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	db := sqliteWithKeys(t, path, "history-key", "")
+
+	// Rows written before payloads existed
+	for _, statement := range []string{
+		`insert into gohistory_attendance ("regNumber", "courseCode", category, conducted, absent, "scrapedAt") values ('RA1', '21CS101T', 'Theory', 40, 8, 1000)`,
+		`insert into gohistory_marks ("regNumber", "courseCode", "courseType", test, scored, total, "scrapedAt") values ('RA1', '21CS101T', 'Theory', 'FT-I', '14.5', 15, 1000)`,
+		`insert into gogpa ("regNumber", semester, "courseCode", "courseTitle", credit, grade, updated_at) values ('RA1', 1, '21CS101T', 'Programming', 4, 'A+', 1000)`,
+	} {
+		if _, err := db.db.Exec(statement); err != nil {
+			t.Fatalf("legacy row: %v", err)
+		}
+	}
+	if err := db.AddAttendanceSnapshots([]types.AttendanceSnapshot{{RegNumber: "RA1", CourseCode: "21CS101T", Category: "Theory", Conducted: 42, Absent: 8, ScrapedAt: 2000}}); err != nil {
+		t.Fatalf("add snapshot: %v", err)
+	}
+
+	result, err := db.Reencrypt()
+	if err != nil {
+		t.Fatalf("reencrypt: %v", err)
+	}
+	if result.Updated != 3 || result.Failed != 0 {
+		t.Errorf("reencrypt %+v, want the 3 legacy rows updated", result)
+	}
+
+	for _, query := range []string{
+		`select count(*) from gohistory_attendance where conducted <> 0 or absent <> 0 or payload not like 'enc:v1:%'`,
+		`select count(*) from gohistory_marks where scored <> '' or total <> 0 or payload not like 'enc:v1:%'`,
+		`select count(*) from gogpa where "courseTitle" <> '' or credit <> 0 or grade <> '' or payload not like 'enc:v1:%'`,
+	} {
+		var plain int
+		if err := db.db.QueryRow(query).Scan(&plain); err != nil || plain != 0 {
+			t.Errorf("%d rows still in plaintext (%v): %s", plain, err, query)
+		}
+	}
+
+	attendance, err := db.GetAttendanceSnapshots("RA1")
+	if err != nil || len(attendance) != 2 || attendance[0].Conducted != 40 || attendance[1].Conducted != 42 || attendance[1].Absent != 8 {
+		t.Errorf("attendance %+v, %v", attendance, err)
+	}
+	marks, err := db.GetMarkSnapshots("RA1")
+	if err != nil || len(marks) != 1 || marks[0].Scored != "14.5" || marks[0].Total != 15 {
+		t.Errorf("marks %+v, %v", marks, err)
+	}
+	grades, err := db.GetGradeEntries("RA1")
+	if err != nil || len(grades[1]) != 1 || grades[1][0].CourseTitle != "Programming" || grades[1][0].Credit != 4 || grades[1][0].Grade != "A+" {
+		t.Errorf("grades %+v, %v", grades, err)
+	}
+
+	// Rotating the key moves every payload onto the new one
+	db.db.Close()
+	rotated := sqliteWithKeys(t, path, "new-key", "history-key")
+	if result, err := rotated.Reencrypt(); err != nil || result.Updated != 4 {
+		t.Errorf("rotation %+v, %v, want 4 rows updated", result, err)
+	}
+	if result, err := rotated.Reencrypt(); err != nil || result.Updated != 0 {
+		t.Errorf("second pass %+v, %v, want nothing to do", result, err)
+	}
+	if grades, err := rotated.GetGradeEntries("RA1"); err != nil || grades[1][0].Grade != "A+" {
+		t.Errorf("grades after rotation %+v, %v", grades, err)
+	}
+}
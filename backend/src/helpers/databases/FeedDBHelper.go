@@ -0,0 +1,81 @@
+package databases
+
+import (
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+)
+
+// CalendarFeed maps the hash of a feed secret to the student it belongs to.
+// Each student has at most one active feed.
+type CalendarFeed struct {
+	ID        string `json:"id"`
+	RegNumber string `json:"regNumber"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// SetFeed stores a new feed for the student, replacing any previous one.
+func (db *DatabaseHelper) SetFeed(regNumber string, secretHash string) (*CalendarFeed, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	feed := CalendarFeed{
+		ID:        secretHash,
+		RegNumber: regNumber,
+		CreatedAt: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+
+	_, _, err := db.client.From("gofeed").Upsert(feed, "regNumber", "", "").Execute()
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (db *DatabaseHelper) FindFeed(secretHash string) (*CalendarFeed, error) {
+	var results []CalendarFeed
+	_, err := db.client.From("gofeed").Select("*", "", false).Eq("id", secretHash).ExecuteTo(&results)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return &results[0], nil
+}
+
+func (db *DatabaseHelper) FindFeedByRegNumber(regNumber string) (*CalendarFeed, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	var results []CalendarFeed
+	_, err := db.client.From("gofeed").Select("*", "", false).Eq("regNumber", regNumber).ExecuteTo(&results)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return &results[0], nil
+}
+
+func (db *DatabaseHelper) feedRegNumbers() ([]string, error) {
+	var regNumbers []string
+	for offset := 0; ; offset += cohortPageSize {
+		var page []CalendarFeed
+		_, err := db.client.From("gofeed").Select("regNumber", "", false).
+			Order("regNumber", &postgrest.OrderOpts{Ascending: true}).
+			Range(offset, offset+cohortPageSize-1, "").ExecuteTo(&page)
+		if err != nil {
+			return nil, err
+		}
+		for _, feed := range page {
+			regNumbers = append(regNumbers, feed.RegNumber)
+		}
+		if len(page) < cohortPageSize {
+			return regNumbers, nil
+		}
+	}
+}
+
+func (db *DatabaseHelper) DeleteFeed(regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	_, _, err := db.client.From("gofeed").Delete("", "").Eq("regNumber", regNumber).Execute()
+	return err
+}
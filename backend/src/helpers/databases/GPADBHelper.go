@@ -0,0 +1,89 @@
+package databases
+
+import (
+	"goscraper/src/types"
+	"strconv"
+	"time"
+)
+
+// GradeRecord is a grade the student entered for a course in a semester. The
+// title, credit and grade are sealed in Payload; rows written before payloads
+// hold them in the plain fields.
+type GradeRecord struct {
+	RegNumber   string  `json:"regNumber"`
+	Semester    int     `json:"semester"`
+	CourseCode  string  `json:"courseCode"`
+	CourseTitle string  `json:"courseTitle"`
+	Credit      float64 `json:"credit"`
+	Grade       string  `json:"grade"`
+	UpdatedAt   int64   `json:"updated_at"`
+	Payload     string  `json:"payload,omitempty"`
+}
+
+// GetGradeEntries returns the student's entered grades grouped by semester.
+func (db *DatabaseHelper) GetGradeEntries(regNumber string) (map[int][]types.GradeEntry, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	var records []GradeRecord
+	_, err := db.client.From("gogpa").Select("*", "", false).Eq("regNumber", regNumber).ExecuteTo(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[int][]types.GradeEntry)
+	for _, record := range records {
+		entry := types.GradeEntry{
+			CourseCode:  record.CourseCode,
+			CourseTitle: record.CourseTitle,
+			Credit:      record.Credit,
+			Grade:       record.Grade,
+		}
+		if err := db.openGradeEntry(&entry, record.Payload); err != nil {
+			return nil, err
+		}
+		entries[record.Semester] = append(entries[record.Semester], entry)
+	}
+	return entries, nil
+}
+
+// ReplaceSemesterGrades replaces every grade the student entered for a
+// semester.
+func (db *DatabaseHelper) ReplaceSemesterGrades(regNumber string, semester int, entries []types.GradeEntry) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	if err := db.DeleteSemesterGrades(regNumber, semester); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	records := make([]GradeRecord, 0, len(entries))
+	for _, entry := range entries {
+		payload, err := db.sealGradeEntry(entry)
+		if err != nil {
+			return err
+		}
+		records = append(records, GradeRecord{
+			RegNumber:  regNumber,
+			Semester:   semester,
+			CourseCode: entry.CourseCode,
+			UpdatedAt:  now,
+			Payload:    payload,
+		})
+	}
+	_, _, err := db.client.From("gogpa").Insert(records, false, "", "", "").Execute()
+	return err
+}
+
+func (db *DatabaseHelper) DeleteSemesterGrades(regNumber string, semester int) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	_, _, err := db.client.From("gogpa").Delete("", "").Eq("regNumber", regNumber).Eq("semester", strconv.Itoa(semester)).Execute()
+	return err
+}
+
+// DeleteGrades removes every grade the student entered.
+func (db *DatabaseHelper) DeleteGrades(regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	_, _, err := db.client.From("gogpa").Delete("minimal", "").Eq("regNumber", regNumber).Execute()
+	return err
+}
@@ -0,0 +1,177 @@
+package databases
+
+import (
+	"goscraper/src/types"
+	"strconv"
+	"strings"
+
+	"github.com/supabase-community/postgrest-go"
+)
+
+// attendanceRecord is a gohistory_attendance row.
+type attendanceRecord struct {
+	types.AttendanceSnapshot
+	Payload string `json:"payload,omitempty"`
+}
+
+// markRecord is a gohistory_marks row.
+type markRecord struct {
+	types.MarkSnapshot
+	Payload string `json:"payload,omitempty"`
+}
+
+// AddAttendanceSnapshots stores attendance snapshots in gohistory_attendance.
+func (db *DatabaseHelper) AddAttendanceSnapshots(snapshots []types.AttendanceSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	records := make([]attendanceRecord, len(snapshots))
+	for i, snapshot := range snapshots {
+		sealed, payload, err := db.sealAttendanceSnapshot(snapshot)
+		if err != nil {
+			return err
+		}
+		records[i] = attendanceRecord{AttendanceSnapshot: sealed, Payload: payload}
+	}
+	_, _, err := db.client.From("gohistory_attendance").Insert(records, false, "", "", "").Execute()
+	return err
+}
+
+// GetAttendanceSnapshots returns a student's attendance snapshots, oldest first.
+func (db *DatabaseHelper) GetAttendanceSnapshots(regNumber string) ([]types.AttendanceSnapshot, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	var records []attendanceRecord
+	_, err := db.client.From("gohistory_attendance").
+		Select("*", "", false).
+		Eq("regNumber", regNumber).
+		Order("scrapedAt", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]types.AttendanceSnapshot, len(records))
+	for i, record := range records {
+		snapshots[i] = record.AttendanceSnapshot
+		if err := db.openAttendanceSnapshot(&snapshots[i], record.Payload); err != nil {
+			return nil, err
+		}
+	}
+	return snapshots, nil
+}
+
+// AddMarkSnapshots stores test score snapshots in gohistory_marks.
+func (db *DatabaseHelper) AddMarkSnapshots(snapshots []types.MarkSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	records := make([]markRecord, len(snapshots))
+	for i, snapshot := range snapshots {
+		sealed, payload, err := db.sealMarkSnapshot(snapshot)
+		if err != nil {
+			return err
+		}
+		records[i] = markRecord{MarkSnapshot: sealed, Payload: payload}
+	}
+	_, _, err := db.client.From("gohistory_marks").Insert(records, false, "", "", "").Execute()
+	return err
+}
+
+// GetMarkSnapshots returns a student's test score snapshots, oldest first.
+func (db *DatabaseHelper) GetMarkSnapshots(regNumber string) ([]types.MarkSnapshot, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	var records []markRecord
+	_, err := db.client.From("gohistory_marks").
+		Select("*", "", false).
+		Eq("regNumber", regNumber).
+		Order("scrapedAt", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]types.MarkSnapshot, len(records))
+	for i, record := range records {
+		snapshots[i] = record.MarkSnapshot
+		if err := db.openMarkSnapshot(&snapshots[i], record.Payload); err != nil {
+			return nil, err
+		}
+	}
+	return snapshots, nil
+}
+
+// DeleteSnapshots removes every attendance and test score snapshot of a
+// student.
+func (db *DatabaseHelper) DeleteSnapshots(regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	for _, table := range []string{"gohistory_attendance", "gohistory_marks"} {
+		if _, _, err := db.client.From(table).Delete("minimal", "").Eq("regNumber", regNumber).Execute(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAttendanceSnapshotsByID removes the given attendance snapshots.
+func (db *DatabaseHelper) DeleteAttendanceSnapshotsByID(ids []int64) error {
+	return db.deleteByID("gohistory_attendance", ids)
+}
+
+// DeleteMarkSnapshotsByID removes the given test score snapshots.
+func (db *DatabaseHelper) DeleteMarkSnapshotsByID(ids []int64) error {
+	return db.deleteByID("gohistory_marks", ids)
+}
+
+func (db *DatabaseHelper) payloadPage(table sealedTable, offset int, limit int) ([]map[string]interface{}, error) {
+	columns := append([]string{}, table.key...)
+	for column := range table.values {
+		columns = append(columns, column)
+	}
+	columns = append(columns, "payload")
+
+	query := db.client.From(table.name).Select(strings.Join(columns, ","), "", false)
+	for _, column := range table.key {
+		query = query.Order(column, &postgrest.OrderOpts{Ascending: true})
+	}
+	var page []map[string]interface{}
+	if _, err := query.Range(offset, offset+limit-1, "").ExecuteTo(&page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (db *DatabaseHelper) updatePayload(table sealedTable, key map[string]interface{}, previous string, payload string) (bool, error) {
+	update := map[string]interface{}{"payload": payload}
+	for column, zero := range table.values {
+		update[column] = zero
+	}
+
+	query := db.client.From(table.name).Update(update, "minimal", "exact")
+	for _, column := range table.key {
+		query = query.Eq(column, keyString(key[column]))
+	}
+	if previous == "" {
+		query = query.Is("payload", "null")
+	} else {
+		query = query.Eq("payload", previous)
+	}
+	_, count, err := query.Execute()
+	return count > 0, err
+}
+
+func (db *DatabaseHelper) deleteByID(table string, ids []int64) error {
+	for start := 0; start < len(ids); start += cohortPageSize {
+		end := start + cohortPageSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		values := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			values = append(values, strconv.FormatInt(id, 10))
+		}
+		if _, _, err := db.client.From(table).Delete("minimal", "").In("id", values).Execute(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
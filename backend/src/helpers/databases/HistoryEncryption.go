@@ -0,0 +1,218 @@
+package databases
+
+import (
+	"encoding/json"
+	"goscraper/src/types"
+	"strconv"
+)
+
+// History and grade rows keep the columns they are looked up and replaced by
+// in plain text, and seal their values as JSON in a payload column with the
+// same key ring as the cached sections. The plain value columns are left at
+// their zero values. Rows written before payloads have a null payload and
+// their values in the plain columns until Reencrypt moves them.
+type sealedTable struct {
+	name string
+	// key identifies a row, and orders pages of the table.
+	key []string
+	// values are the plain value columns with the zero value they are left at.
+	values map[string]interface{}
+}
+
+// column is the name bound to a table's payloads, so one can't be moved to
+// another table.
+func (t sealedTable) column() string {
+	return t.name + ".payload"
+}
+
+var (
+	attendanceHistoryTable = sealedTable{
+		name:   "gohistory_attendance",
+		key:    []string{"id"},
+		values: map[string]interface{}{"conducted": 0, "absent": 0},
+	}
+	marksHistoryTable = sealedTable{
+		name:   "gohistory_marks",
+		key:    []string{"id"},
+		values: map[string]interface{}{"scored": "", "total": 0},
+	}
+	gradesTable = sealedTable{
+		name:   "gogpa",
+		key:    []string{"regNumber", "semester", "courseCode"},
+		values: map[string]interface{}{"courseTitle": "", "credit": 0, "grade": ""},
+	}
+
+	sealedTables = []sealedTable{attendanceHistoryTable, marksHistoryTable, gradesTable}
+)
+
+// payloadRows is the storage a backend provides for the tables with sealed
+// payloads.
+type payloadRows interface {
+	// payloadPage returns the key columns, plain value columns and payload of
+	// a table's rows, ordered by key.
+	payloadPage(table sealedTable, offset int, limit int) ([]map[string]interface{}, error)
+	// updatePayload sets the payload of the row with the given key, and
+	// clears its plain value columns, if its payload still equals previous.
+	// An empty previous matches a null payload.
+	updatePayload(table sealedTable, key map[string]interface{}, previous string, payload string) (bool, error)
+}
+
+type attendancePayload struct {
+	Conducted int `json:"conducted"`
+	Absent    int `json:"absent"`
+}
+
+type markPayload struct {
+	Scored string  `json:"scored"`
+	Total  float64 `json:"total"`
+}
+
+type gradePayload struct {
+	CourseTitle string  `json:"courseTitle"`
+	Credit      float64 `json:"credit"`
+	Grade       string  `json:"grade"`
+}
+
+func (db *studentCache) sealPayload(table sealedTable, value interface{}) (string, error) {
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return db.keys.seal(table.column(), string(jsonBytes))
+}
+
+// openPayload opens a stored payload into target. An empty payload leaves
+// target as it is, holding the values read from the plain columns.
+func (db *studentCache) openPayload(table sealedTable, payload string, target interface{}) error {
+	if payload == "" {
+		return nil
+	}
+	plaintext, err := db.keys.open(table.column(), payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(plaintext), target)
+}
+
+// sealAttendanceSnapshot returns the snapshot with its values cleared and
+// their sealed payload.
+func (db *studentCache) sealAttendanceSnapshot(snapshot types.AttendanceSnapshot) (types.AttendanceSnapshot, string, error) {
+	payload, err := db.sealPayload(attendanceHistoryTable, attendancePayload{
+		Conducted: snapshot.Conducted,
+		Absent:    snapshot.Absent,
+	})
+	snapshot.RegNumber = NormalizeRegNumber(snapshot.RegNumber)
+	snapshot.Conducted, snapshot.Absent = 0, 0
+	return snapshot, payload, err
+}
+
+func (db *studentCache) openAttendanceSnapshot(snapshot *types.AttendanceSnapshot, payload string) error {
+	values := attendancePayload{Conducted: snapshot.Conducted, Absent: snapshot.Absent}
+	if err := db.openPayload(attendanceHistoryTable, payload, &values); err != nil {
+		return err
+	}
+	snapshot.Conducted, snapshot.Absent = values.Conducted, values.Absent
+	return nil
+}
+
+// sealMarkSnapshot returns the snapshot with its values cleared and their
+// sealed payload.
+func (db *studentCache) sealMarkSnapshot(snapshot types.MarkSnapshot) (types.MarkSnapshot, string, error) {
+	payload, err := db.sealPayload(marksHistoryTable, markPayload{
+		Scored: snapshot.Scored,
+		Total:  snapshot.Total,
+	})
+	snapshot.RegNumber = NormalizeRegNumber(snapshot.RegNumber)
+	snapshot.Scored, snapshot.Total = "", 0
+	return snapshot, payload, err
+}
+
+func (db *studentCache) openMarkSnapshot(snapshot *types.MarkSnapshot, payload string) error {
+	values := markPayload{Scored: snapshot.Scored, Total: snapshot.Total}
+	if err := db.openPayload(marksHistoryTable, payload, &values); err != nil {
+		return err
+	}
+	snapshot.Scored, snapshot.Total = values.Scored, values.Total
+	return nil
+}
+
+func (db *studentCache) sealGradeEntry(entry types.GradeEntry) (string, error) {
+	return db.sealPayload(gradesTable, gradePayload{
+		CourseTitle: entry.CourseTitle,
+		Credit:      entry.Credit,
+		Grade:       entry.Grade,
+	})
+}
+
+func (db *studentCache) openGradeEntry(entry *types.GradeEntry, payload string) error {
+	values := gradePayload{CourseTitle: entry.CourseTitle, Credit: entry.Credit, Grade: entry.Grade}
+	if err := db.openPayload(gradesTable, payload, &values); err != nil {
+		return err
+	}
+	entry.CourseTitle, entry.Credit, entry.Grade = values.CourseTitle, values.Credit, values.Grade
+	return nil
+}
+
+// reencryptPayloads seals every payload of a table that isn't sealed with
+// the active key, including rows whose values are still in plain columns.
+func (db *studentCache) reencryptPayloads(table sealedTable, result *ReencryptResult) error {
+	for offset := 0; ; offset += cohortPageSize {
+		page, err := db.rows.payloadPage(table, offset, cohortPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range page {
+			result.Rows++
+			stored := stringValue(row["payload"])
+			if stored != "" && db.keys.current(stored) {
+				continue
+			}
+
+			var plaintext string
+			if stored == "" {
+				values := make(map[string]interface{}, len(table.values))
+				for column := range table.values {
+					values[column] = row[column]
+				}
+				jsonBytes, err := json.Marshal(values)
+				if err != nil {
+					return err
+				}
+				plaintext = string(jsonBytes)
+			} else if plaintext, err = db.keys.open(table.column(), stored); err != nil {
+				result.Failed++
+				continue
+			}
+
+			sealed, err := db.keys.seal(table.column(), plaintext)
+			if err != nil {
+				return err
+			}
+			key := make(map[string]interface{}, len(table.key))
+			for _, column := range table.key {
+				key[column] = row[column]
+			}
+			updated, err := db.rows.updatePayload(table, key, stored, sealed)
+			if err != nil {
+				return err
+			}
+			if updated {
+				result.Updated++
+			}
+		}
+
+		if len(page) < cohortPageSize {
+			return nil
+		}
+	}
+}
+
+// keyString formats a key column for a filter.
+func keyString(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	n, _ := int64Value(value)
+	return strconv.FormatInt(n, 10)
+}
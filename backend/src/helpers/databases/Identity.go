@@ -0,0 +1,352 @@
+package databases
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// NormalizeRegNumber canonicalizes a registration number so the same student
+// always maps to the same cache row.
+func NormalizeRegNumber(regNumber string) string {
+	return strings.ToUpper(strings.TrimSpace(regNumber))
+}
+
+// studentID is a student's cache identity: an HMAC-SHA256 of the normalized
+// registration number under CACHE_ID_KEY. Changing the key changes every id,
+// after which the rekey tool has to be run.
+func (db *studentCache) studentID(regNumber string) string {
+	mac := hmac.New(sha256.New, db.idKey)
+	mac.Write([]byte(regNumber))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (db *studentCache) sessionStudent(sessionHash string) (string, error) {
+	if sessionHash == "" {
+		return "", nil
+	}
+	if id, ok := db.links.Load(sessionHash); ok {
+		return id.(string), nil
+	}
+
+	id, err := db.rows.sessionStudent(sessionHash)
+	if err != nil {
+		return "", err
+	}
+	if id != "" {
+		db.links.Store(sessionHash, id)
+	}
+	return id, nil
+}
+
+func (db *studentCache) linkSession(sessionHash string, id string) error {
+	if sessionHash == "" {
+		return nil
+	}
+	if current, ok := db.links.Load(sessionHash); ok && current.(string) == id {
+		return nil
+	}
+	if err := db.rows.linkSession(sessionHash, id); err != nil {
+		return err
+	}
+	db.links.Store(sessionHash, id)
+	return nil
+}
+
+// CacheIdentity is who a session's cached responses belong to: the student's
+// id once the session is linked to one, and the session hash until then, so
+// tokens never become cache keys.
+func (db *studentCache) CacheIdentity(sessionHash string) string {
+	if id, err := db.sessionStudent(sessionHash); err == nil && id != "" {
+		return id
+	}
+	return "session:" + sessionHash
+}
+
+// InvalidateSession drops the cached responses of a session and of the
+// student it is linked to.
+func (db *studentCache) InvalidateSession(sessionHash string) {
+	Responses().InvalidateIdentity(db.CacheIdentity(sessionHash))
+	Responses().InvalidateIdentity("session:" + sessionHash)
+}
+
+// StudentSession is a session linked to a student. ID is the session hash.
+type StudentSession struct {
+	ID        string `json:"id"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// StudentSessions returns the sessions linked to a student.
+func (db *studentCache) StudentSessions(regNumber string) ([]StudentSession, error) {
+	return db.rows.studentSessions(db.studentID(NormalizeRegNumber(regNumber)))
+}
+
+// LinkSession links a session to a student before any of their sections is
+// written, so the session can be found and revoked through the student.
+func (db *studentCache) LinkSession(sessionHash string, regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	if regNumber == "" {
+		return nil
+	}
+	return db.linkSession(sessionHash, db.studentID(regNumber))
+}
+
+// DeleteStudent removes a student's cache row and revokes every session
+// linked to it.
+func (db *studentCache) DeleteStudent(regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	id := db.studentID(regNumber)
+
+	if err := db.rows.deleteStudentSessions(id); err != nil {
+		return err
+	}
+	db.links.Range(func(hash, linked interface{}) bool {
+		if linked.(string) == id {
+			db.links.Delete(hash)
+		}
+		return true
+	})
+	Responses().InvalidateIdentity(id)
+	return db.rows.deleteStudent(regNumber)
+}
+
+// StudentRegNumbers returns the registration number of every cached student.
+func (db *studentCache) StudentRegNumbers() ([]string, error) {
+	return db.regNumbersWhere(func(map[string]interface{}) bool { return true })
+}
+
+func (db *studentCache) regNumbersWhere(match func(row map[string]interface{}) bool) ([]string, error) {
+	var regNumbers []string
+	for offset := 0; ; offset += cohortPageSize {
+		page, err := db.rows.studentPage(offset, cohortPageSize, "regNumber,lastUpdated")
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range page {
+			if regNumber := stringValue(row["regNumber"]); regNumber != "" && match(row) {
+				regNumbers = append(regNumbers, regNumber)
+			}
+		}
+		if len(page) < cohortPageSize {
+			return regNumbers, nil
+		}
+	}
+}
+
+// RekeyResult counts what a rekey pass did.
+type RekeyResult struct {
+	Rows     int `json:"rows"`
+	Rekeyed  int `json:"rekeyed"`
+	Merged   int `json:"merged"`
+	Orphaned int `json:"orphaned"`
+	Skipped  int `json:"skipped"`
+}
+
+// Rekey gives every goscrape row the id derived from its normalized
+// registration number. Rows whose registration numbers normalize to the same
+// student are merged into one, keeping the most recently fetched copy of each
+// section, and rows without a registration number are deleted. A student whose
+// rows keep changing while the pass runs is skipped and counted.
+func (db *studentCache) Rekey() (RekeyResult, error) {
+	var result RekeyResult
+
+	groups := make(map[string][]map[string]interface{})
+	var order []string
+	for offset := 0; ; offset += cohortPageSize {
+		page, err := db.rows.studentPage(offset, cohortPageSize, "*")
+		if err != nil {
+			return result, err
+		}
+		for _, row := range page {
+			result.Rows++
+			regNumber := NormalizeRegNumber(stringValue(row["regNumber"]))
+			if _, seen := groups[regNumber]; !seen {
+				order = append(order, regNumber)
+			}
+			groups[regNumber] = append(groups[regNumber], row)
+		}
+		if len(page) < cohortPageSize {
+			break
+		}
+	}
+
+	for _, regNumber := range order {
+		if regNumber == "" {
+			// A null regNumber reads as "", which deleteStudent can't match
+			blanks := make(map[string]bool)
+			for _, row := range groups[regNumber] {
+				blanks[stringValue(row["regNumber"])] = true
+			}
+			for blank := range blanks {
+				deleted, err := db.rows.deleteBlankStudents(blank)
+				if err != nil {
+					return result, err
+				}
+				result.Orphaned += deleted
+			}
+			continue
+		}
+
+		rekeyed, merged, err := db.rekeyStudent(regNumber, groups[regNumber])
+		if errors.Is(err, ErrWriteConflict) {
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if rekeyed {
+			result.Rekeyed++
+		}
+		result.Merged += merged
+	}
+	return result, nil
+}
+
+// rekeyStudent merges one student's rows into the keeper and gives it the id
+// of the normalized registration number, returning whether the keeper changed
+// and how many duplicates were deleted. Duplicates are only deleted once the
+// keeper holds their sections, so a lost race leaves every row in place and
+// the group is read again and merged anew.
+func (db *studentCache) rekeyStudent(regNumber string, rows []map[string]interface{}) (bool, int, error) {
+	id := db.studentID(regNumber)
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(rand.Int63n(int64(writeBackoff) * int64(attempt))))
+			var err error
+			if rows, err = db.reloadRows(regNumber, rows); err != nil {
+				return false, 0, err
+			}
+			if len(rows) == 0 {
+				return false, 0, nil
+			}
+		}
+
+		keeper := rekeyKeeper(regNumber, rows)
+		keeperRegNumber := stringValue(keeper["regNumber"])
+		if len(rows) == 1 && stringValue(keeper["id"]) == id && keeperRegNumber == regNumber {
+			return false, 0, nil
+		}
+
+		update := db.mergeRows(rows)
+		update["id"] = id
+		update["regNumber"] = regNumber
+		revision, _ := int64Value(keeper["revision"])
+		update["revision"] = revision + 1
+		updated, err := db.rows.updateStudent(keeperRegNumber, revision, update)
+		if err != nil {
+			return false, 0, err
+		}
+		if !updated {
+			continue
+		}
+
+		merged := 0
+		for _, row := range rows {
+			if stringValue(row["regNumber"]) == keeperRegNumber {
+				continue
+			}
+			if err := db.rows.deleteStudent(stringValue(row["regNumber"])); err != nil {
+				return true, merged, err
+			}
+			merged++
+		}
+		return true, merged, nil
+	}
+	return false, 0, ErrWriteConflict
+}
+
+// reloadRows reads a student's rows again by the registration numbers they
+// were found under, plus the normalized one in case it was written since.
+func (db *studentCache) reloadRows(regNumber string, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	regNumbers := []string{regNumber}
+	for _, row := range rows {
+		regNumbers = append(regNumbers, stringValue(row["regNumber"]))
+	}
+
+	var reloaded []map[string]interface{}
+	seen := make(map[string]bool)
+	for _, raw := range regNumbers {
+		if seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		row, err := db.rows.findStudent("regNumber", raw, "*")
+		if err != nil {
+			return nil, err
+		}
+		if row != nil {
+			reloaded = append(reloaded, row)
+		}
+	}
+	return reloaded, nil
+}
+
+// rekeyKeeper picks the row a group is merged into: the one already stored
+// under the normalized registration number, else the most recently updated.
+func rekeyKeeper(regNumber string, rows []map[string]interface{}) map[string]interface{} {
+	keeper := rows[0]
+	for _, row := range rows {
+		if stringValue(row["regNumber"]) == regNumber {
+			return row
+		}
+		if updated, _ := int64Value(row["lastUpdated"]); updated > lastUpdatedOf(keeper) {
+			keeper = row
+		}
+	}
+	return keeper
+}
+
+// mergeRows combines rows of one student, taking each section from the row
+// that fetched it last and ophour from the most recently updated row that has
+// one.
+func (db *studentCache) mergeRows(rows []map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{
+		"lastUpdated": time.Now().UnixNano() / int64(time.Millisecond),
+	}
+
+	var ophourAt int64 = -1
+	for _, row := range rows {
+		if ophour := stringValue(row["ophour"]); ophour != "" && lastUpdatedOf(row) > ophourAt {
+			merged["ophour"] = ophour
+			ophourAt = lastUpdatedOf(row)
+		}
+	}
+
+	for _, section := range sectionColumns {
+		var newest int64 = -1
+		for _, row := range rows {
+			stored := stringValue(row[section])
+			if stored == "" {
+				continue
+			}
+			fetchedAt := lastUpdatedOf(row)
+			if _, meta, err := db.openSection(section, stored); err != nil {
+				fetchedAt = -1
+			} else if meta != nil {
+				fetchedAt = meta.FetchedAt
+			}
+			if fetchedAt > newest || merged[section] == nil {
+				merged[section] = stored
+				if fetchedAt > newest {
+					newest = fetchedAt
+				}
+			}
+		}
+	}
+	return merged
+}
+
+func lastUpdatedOf(row map[string]interface{}) int64 {
+	updated, _ := int64Value(row["lastUpdated"])
+	return updated
+}
+
+func stringValue(value interface{}) string {
+	str, _ := value.(string)
+	return str
+}
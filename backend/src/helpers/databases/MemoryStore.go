@@ -0,0 +1,562 @@
+package databases
+
+import (
+	"errors"
+	"goscraper/src/types"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps everything in process memory. It suits development and
+// tests; nothing survives a restart.
+type MemoryStore struct {
+	studentCache
+
+	mu          sync.RWMutex
+	students    map[string]map[string]interface{}
+	events      map[string][]CalendarEvent
+	sessions    map[string]int64
+	links       map[string]string
+	feeds       map[string]CalendarFeed
+	attendance  []types.AttendanceSnapshot
+	marks       []types.MarkSnapshot
+	grades      map[string]map[int][]types.GradeEntry
+	gradesAt    map[string]int64
+	optOuts     map[string]int64
+	nextHistory int64
+
+	calendarHashes  map[string]string
+	calendarChanges []types.CalendarChange
+}
+
+func NewMemoryStore() *MemoryStore {
+	db := &MemoryStore{
+		students: make(map[string]map[string]interface{}),
+		events:   make(map[string][]CalendarEvent),
+		sessions: make(map[string]int64),
+		links:    make(map[string]string),
+		feeds:    make(map[string]CalendarFeed),
+		grades:   make(map[string]map[int][]types.GradeEntry),
+		gradesAt: make(map[string]int64),
+		optOuts:  make(map[string]int64),
+
+		calendarHashes: make(map[string]string),
+	}
+	db.studentCache = newStudentCache(db)
+	return db
+}
+
+func copyRow(row map[string]interface{}, columns string) map[string]interface{} {
+	result := make(map[string]interface{}, len(row))
+	if columns == "*" {
+		for key, value := range row {
+			result[key] = value
+		}
+		return result
+	}
+	for _, column := range strings.Split(columns, ",") {
+		column = strings.TrimSpace(column)
+		if value, ok := row[column]; ok {
+			result[column] = value
+		}
+	}
+	return result
+}
+
+func (db *MemoryStore) findStudent(column string, value string, columns string) (map[string]interface{}, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, row := range db.students {
+		if current, ok := row[column].(string); ok && current == value {
+			return copyRow(row, columns), nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *MemoryStore) insertStudent(row map[string]interface{}) (bool, error) {
+	regNumber, _ := row["regNumber"].(string)
+	if regNumber == "" {
+		return false, errors.New("regNumber is required")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.students[regNumber]; exists {
+		return false, nil
+	}
+	db.students[regNumber] = copyRow(row, "*")
+	return true, nil
+}
+
+func (db *MemoryStore) updateStudent(regNumber string, revision int64, row map[string]interface{}) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	existing, ok := db.students[regNumber]
+	if !ok {
+		return false, nil
+	}
+	if current, _ := int64Value(existing["revision"]); current != revision {
+		return false, nil
+	}
+	for key, value := range row {
+		existing[key] = value
+	}
+	if renamed, _ := existing["regNumber"].(string); renamed != regNumber {
+		delete(db.students, regNumber)
+		db.students[renamed] = existing
+	}
+	return true, nil
+}
+
+func (db *MemoryStore) deleteStudent(regNumber string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.students, regNumber)
+	return nil
+}
+
+// InactiveStudents returns the registration numbers found in any of the
+// store's per-student data whose latest write is before the given time in
+// milliseconds.
+func (db *MemoryStore) InactiveStudents(before int64) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	latest := make(map[string]int64)
+	for regNumber, row := range db.students {
+		noteWrite(latest, regNumber, lastUpdatedOf(row))
+	}
+	for _, snapshot := range db.attendance {
+		noteWrite(latest, snapshot.RegNumber, snapshot.ScrapedAt)
+	}
+	for _, snapshot := range db.marks {
+		noteWrite(latest, snapshot.RegNumber, snapshot.ScrapedAt)
+	}
+	for regNumber, semesters := range db.grades {
+		if len(semesters) > 0 {
+			noteWrite(latest, regNumber, db.gradesAt[regNumber])
+		}
+	}
+	for _, feed := range db.feeds {
+		noteWrite(latest, feed.RegNumber, feed.CreatedAt)
+	}
+	for regNumber, optedOut := range db.optOuts {
+		noteWrite(latest, regNumber, optedOut)
+	}
+	return writtenBefore(latest, before), nil
+}
+
+func (db *MemoryStore) deleteBlankStudents(regNumber string) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.students[regNumber]; !ok {
+		return 0, nil
+	}
+	delete(db.students, regNumber)
+	return 1, nil
+}
+
+func (db *MemoryStore) studentPage(offset int, limit int, columns string) ([]map[string]interface{}, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	regNumbers := make([]string, 0, len(db.students))
+	for regNumber := range db.students {
+		regNumbers = append(regNumbers, regNumber)
+	}
+	sort.Strings(regNumbers)
+
+	var page []map[string]interface{}
+	for i := offset; i < len(regNumbers) && i < offset+limit; i++ {
+		page = append(page, copyRow(db.students[regNumbers[i]], columns))
+	}
+	return page, nil
+}
+
+func (db *MemoryStore) GetCalendarEvents(term string) ([]CalendarEvent, string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return append([]CalendarEvent(nil), db.events[term]...), db.calendarHashes[term], nil
+}
+
+func (db *MemoryStore) ReplaceCalendarEvents(term string, previousHash string, hash string, events []CalendarEvent, changes []types.CalendarChange) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.calendarHashes[term] != previousHash {
+		return false, nil
+	}
+	db.events[term] = append([]CalendarEvent(nil), events...)
+	db.calendarHashes[term] = hash
+	db.calendarChanges = append(db.calendarChanges, changes...)
+	return true, nil
+}
+
+func (db *MemoryStore) GetCalendarChanges(term string, limit int) ([]types.CalendarChange, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	changes := []types.CalendarChange{}
+	for i := len(db.calendarChanges) - 1; i >= 0 && len(changes) < limit; i-- {
+		if db.calendarChanges[i].Term == term {
+			changes = append(changes, db.calendarChanges[i])
+		}
+	}
+	return changes, nil
+}
+
+func (db *MemoryStore) AddSession(hash string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.sessions[hash] = time.Now().UnixNano() / int64(time.Millisecond)
+	return nil
+}
+
+func (db *MemoryStore) HasSession(hash string) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	_, ok := db.sessions[hash]
+	return ok, nil
+}
+
+func (db *MemoryStore) DeleteSession(hash string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.sessions, hash)
+	delete(db.links, hash)
+	return nil
+}
+
+func (db *MemoryStore) DeleteAllSessions() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.sessions = make(map[string]int64)
+	db.links = make(map[string]string)
+	return nil
+}
+
+func (db *MemoryStore) DeleteSessionsBefore(createdBefore int64) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	deleted := 0
+	for hash, createdAt := range db.sessions {
+		if createdAt < createdBefore {
+			delete(db.sessions, hash)
+			delete(db.links, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (db *MemoryStore) linkSession(sessionHash string, studentID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.sessions[sessionHash]; ok {
+		db.links[sessionHash] = studentID
+	}
+	return nil
+}
+
+func (db *MemoryStore) studentSessions(studentID string) ([]StudentSession, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var sessions []StudentSession
+	for hash, linked := range db.links {
+		if linked == studentID {
+			sessions = append(sessions, StudentSession{ID: hash, CreatedAt: db.sessions[hash]})
+		}
+	}
+	return sessions, nil
+}
+
+func (db *MemoryStore) deleteStudentSessions(studentID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for hash, linked := range db.links {
+		if linked == studentID {
+			delete(db.links, hash)
+			delete(db.sessions, hash)
+		}
+	}
+	return nil
+}
+
+func (db *MemoryStore) sessionStudent(sessionHash string) (string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.links[sessionHash], nil
+}
+
+func (db *MemoryStore) SetFeed(regNumber string, secretHash string) (*CalendarFeed, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for id, feed := range db.feeds {
+		if feed.RegNumber == regNumber {
+			delete(db.feeds, id)
+		}
+	}
+	feed := CalendarFeed{
+		ID:        secretHash,
+		RegNumber: regNumber,
+		CreatedAt: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	db.feeds[secretHash] = feed
+	return &feed, nil
+}
+
+func (db *MemoryStore) FindFeed(secretHash string) (*CalendarFeed, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	feed, ok := db.feeds[secretHash]
+	if !ok {
+		return nil, nil
+	}
+	return &feed, nil
+}
+
+func (db *MemoryStore) FindFeedByRegNumber(regNumber string) (*CalendarFeed, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, feed := range db.feeds {
+		if feed.RegNumber == regNumber {
+			return &feed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *MemoryStore) feedRegNumbers() ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var regNumbers []string
+	for _, feed := range db.feeds {
+		regNumbers = append(regNumbers, feed.RegNumber)
+	}
+	return regNumbers, nil
+}
+
+func (db *MemoryStore) DeleteFeed(regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for id, feed := range db.feeds {
+		if feed.RegNumber == regNumber {
+			delete(db.feeds, id)
+		}
+	}
+	return nil
+}
+
+// History and grades are kept as values in process memory, which is never at
+// rest, so there are no payloads to seal.
+func (db *MemoryStore) payloadPage(table sealedTable, offset int, limit int) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (db *MemoryStore) updatePayload(table sealedTable, key map[string]interface{}, previous string, payload string) (bool, error) {
+	return false, nil
+}
+
+func (db *MemoryStore) AddAttendanceSnapshots(snapshots []types.AttendanceSnapshot) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, snapshot := range snapshots {
+		db.nextHistory++
+		snapshot.ID = db.nextHistory
+		snapshot.RegNumber = NormalizeRegNumber(snapshot.RegNumber)
+		db.attendance = append(db.attendance, snapshot)
+	}
+	return nil
+}
+
+func (db *MemoryStore) GetAttendanceSnapshots(regNumber string) ([]types.AttendanceSnapshot, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var snapshots []types.AttendanceSnapshot
+	for _, snapshot := range db.attendance {
+		if snapshot.RegNumber == regNumber {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+func (db *MemoryStore) AddMarkSnapshots(snapshots []types.MarkSnapshot) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, snapshot := range snapshots {
+		db.nextHistory++
+		snapshot.ID = db.nextHistory
+		snapshot.RegNumber = NormalizeRegNumber(snapshot.RegNumber)
+		db.marks = append(db.marks, snapshot)
+	}
+	return nil
+}
+
+func (db *MemoryStore) GetMarkSnapshots(regNumber string) ([]types.MarkSnapshot, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var snapshots []types.MarkSnapshot
+	for _, snapshot := range db.marks {
+		if snapshot.RegNumber == regNumber {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+func (db *MemoryStore) DeleteSnapshots(regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	attendance := db.attendance[:0]
+	for _, snapshot := range db.attendance {
+		if snapshot.RegNumber != regNumber {
+			attendance = append(attendance, snapshot)
+		}
+	}
+	db.attendance = attendance
+
+	marks := db.marks[:0]
+	for _, snapshot := range db.marks {
+		if snapshot.RegNumber != regNumber {
+			marks = append(marks, snapshot)
+		}
+	}
+	db.marks = marks
+	return nil
+}
+
+func (db *MemoryStore) DeleteAttendanceSnapshotsByID(ids []int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	remove := idSet(ids)
+	attendance := db.attendance[:0]
+	for _, snapshot := range db.attendance {
+		if !remove[snapshot.ID] {
+			attendance = append(attendance, snapshot)
+		}
+	}
+	db.attendance = attendance
+	return nil
+}
+
+func (db *MemoryStore) DeleteMarkSnapshotsByID(ids []int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	remove := idSet(ids)
+	marks := db.marks[:0]
+	for _, snapshot := range db.marks {
+		if !remove[snapshot.ID] {
+			marks = append(marks, snapshot)
+		}
+	}
+	db.marks = marks
+	return nil
+}
+
+func idSet(ids []int64) map[int64]bool {
+	set := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func (db *MemoryStore) GetGradeEntries(regNumber string) (map[int][]types.GradeEntry, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	entries := make(map[int][]types.GradeEntry)
+	for semester, grades := range db.grades[regNumber] {
+		entries[semester] = append([]types.GradeEntry(nil), grades...)
+	}
+	return entries, nil
+}
+
+func (db *MemoryStore) ReplaceSemesterGrades(regNumber string, semester int, entries []types.GradeEntry) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.grades[regNumber] == nil {
+		db.grades[regNumber] = make(map[int][]types.GradeEntry)
+	}
+	db.gradesAt[regNumber] = time.Now().UnixNano() / int64(time.Millisecond)
+	if len(entries) == 0 {
+		delete(db.grades[regNumber], semester)
+		return nil
+	}
+	db.grades[regNumber][semester] = append([]types.GradeEntry(nil), entries...)
+	return nil
+}
+
+func (db *MemoryStore) DeleteSemesterGrades(regNumber string, semester int) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.grades[regNumber], semester)
+	return nil
+}
+
+func (db *MemoryStore) DeleteGrades(regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.grades, regNumber)
+	delete(db.gradesAt, regNumber)
+	return nil
+}
+
+func (db *MemoryStore) SetCohortOptOut(regNumber string, optOut bool) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if optOut {
+		if _, ok := db.optOuts[regNumber]; !ok {
+			db.optOuts[regNumber] = time.Now().UnixNano() / int64(time.Millisecond)
+		}
+	} else {
+		delete(db.optOuts, regNumber)
+	}
+	return nil
+}
+
+func (db *MemoryStore) GetCohortOptOuts() (map[string]bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	optOuts := make(map[string]bool, len(db.optOuts))
+	for regNumber := range db.optOuts {
+		optOuts[NormalizeRegNumber(regNumber)] = true
+	}
+	return optOuts, nil
+}
@@ -0,0 +1,262 @@
+package databases
+
+import (
+	"container/list"
+	"goscraper/src/types"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultResponseCacheEntries = 10000
+	defaultResponseCacheMB      = 64
+	defaultResponseCacheTTL     = 2 * time.Minute
+)
+
+// CachedResponse is a response body kept in the in-process cache.
+type CachedResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type responseEntry struct {
+	key      string
+	identity string
+	sections []string
+	response CachedResponse
+	size     int64
+	expires  time.Time
+}
+
+// ResponseCache is the in-process tier in front of the persistent store: a
+// size-limited LRU of response bodies. Entries belong to a student identity,
+// or to no one when they are the same for everyone, and are tagged with the
+// sections they were built from so they can be invalidated together.
+type ResponseCache struct {
+	mu         sync.Mutex
+	order      *list.List
+	entries    map[string]*list.Element
+	byIdentity map[string]map[string]*list.Element
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+
+	// generation changes on every invalidation, so a response built before
+	// one is not stored after it
+	generation uint64
+
+	hits, misses, evictions, expirations, invalidations int64
+	storeHits, storeMisses                              int64
+}
+
+var (
+	responses     *ResponseCache
+	responsesOnce sync.Once
+)
+
+// Responses is the process's response cache, sized by
+// RESPONSE_CACHE_MAX_ENTRIES and RESPONSE_CACHE_MAX_MB, with entries kept for
+// RESPONSE_CACHE_TTL.
+func Responses() *ResponseCache {
+	responsesOnce.Do(func() {
+		entries := defaultResponseCacheEntries
+		if n, err := strconv.Atoi(os.Getenv("RESPONSE_CACHE_MAX_ENTRIES")); err == nil && n > 0 {
+			entries = n
+		}
+		megabytes := defaultResponseCacheMB
+		if n, err := strconv.Atoi(os.Getenv("RESPONSE_CACHE_MAX_MB")); err == nil && n > 0 {
+			megabytes = n
+		}
+		ttl := defaultResponseCacheTTL
+		if d, err := time.ParseDuration(os.Getenv("RESPONSE_CACHE_TTL")); err == nil && d > 0 {
+			ttl = d
+		}
+		responses = NewResponseCache(entries, int64(megabytes)<<20, ttl)
+	})
+	return responses
+}
+
+func NewResponseCache(maxEntries int, maxBytes int64, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		byIdentity: make(map[string]map[string]*list.Element),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ttl:        ttl,
+	}
+}
+
+func responseKey(identity string, variant string) string {
+	return identity + "\x00" + variant
+}
+
+// Get returns the cached response for an identity and request variant, such
+// as the URL. On a miss it returns the generation to hand back to Set.
+func (c *ResponseCache) Get(identity string, variant string) (*CachedResponse, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[responseKey(identity, variant)]
+	if ok {
+		entry := element.Value.(*responseEntry)
+		if time.Now().Before(entry.expires) {
+			c.order.MoveToFront(element)
+			c.hits++
+			response := entry.response
+			return &response, c.generation, true
+		}
+		c.remove(element)
+		c.expirations++
+	}
+	c.misses++
+	return nil, c.generation, false
+}
+
+// Set stores a response unless the cache was invalidated since the
+// generation was read, evicting the least recently used entries to stay
+// within the size limits.
+func (c *ResponseCache) Set(identity string, variant string, sections []string, response CachedResponse, generation uint64) {
+	size := int64(len(response.Body) + len(identity) + len(variant))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation || size > c.maxBytes {
+		return
+	}
+
+	key := responseKey(identity, variant)
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	entry := &responseEntry{
+		key:      key,
+		identity: identity,
+		sections: sections,
+		response: response,
+		size:     size,
+		expires:  time.Now().Add(c.ttl),
+	}
+	element := c.order.PushFront(entry)
+	c.entries[key] = element
+	if c.byIdentity[identity] == nil {
+		c.byIdentity[identity] = make(map[string]*list.Element)
+	}
+	c.byIdentity[identity][key] = element
+	c.bytes += size
+
+	for len(c.entries) > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// remove drops an entry. The caller holds c.mu.
+func (c *ResponseCache) remove(element *list.Element) {
+	entry := element.Value.(*responseEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	if keys := c.byIdentity[entry.identity]; keys != nil {
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(c.byIdentity, entry.identity)
+		}
+	}
+	c.bytes -= entry.size
+}
+
+// InvalidateIdentity drops every response cached for an identity.
+func (c *ResponseCache) InvalidateIdentity(identity string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, element := range c.byIdentity[identity] {
+		c.remove(element)
+		c.invalidations++
+	}
+}
+
+// InvalidateSection drops every response built from a section, for every
+// identity.
+func (c *ResponseCache) InvalidateSection(section string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		for _, tagged := range element.Value.(*responseEntry).sections {
+			if tagged == section {
+				c.remove(element)
+				c.invalidations++
+				break
+			}
+		}
+		element = next
+	}
+}
+
+// InvalidateAll empties the cache.
+func (c *ResponseCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.invalidations += int64(len(c.entries))
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.byIdentity = make(map[string]map[string]*list.Element)
+	c.bytes = 0
+}
+
+// RecordStoreLookup counts whether a read was answered by a fresh section in
+// the persistent store.
+func (c *ResponseCache) RecordStoreLookup(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hit {
+		c.storeHits++
+	} else {
+		c.storeMisses++
+	}
+}
+
+func hitRate(hits int64, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// Metrics reports hits and misses of both tiers and the memory tier's size.
+func (c *ResponseCache) Metrics() types.CacheMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return types.CacheMetrics{
+		Memory: types.MemoryCacheMetrics{
+			Hits:          c.hits,
+			Misses:        c.misses,
+			HitRate:       hitRate(c.hits, c.misses),
+			Evictions:     c.evictions,
+			Expirations:   c.expirations,
+			Invalidations: c.invalidations,
+			Entries:       len(c.entries),
+			Bytes:         c.bytes,
+			MaxEntries:    c.maxEntries,
+			MaxBytes:      c.maxBytes,
+		},
+		Store: types.StoreCacheMetrics{
+			Hits:    c.storeHits,
+			Misses:  c.storeMisses,
+			HitRate: hitRate(c.storeHits, c.storeMisses),
+		},
+	}
+}
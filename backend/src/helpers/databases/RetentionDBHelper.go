@@ -0,0 +1,75 @@
+package databases
+
+import (
+	"sort"
+
+	"github.com/supabase-community/postgrest-go"
+)
+
+// studentTable is a table keyed by registration number: written is the column
+// recording when a row was written, and order pages through it without ties.
+type studentTable struct {
+	name    string
+	written string
+	order   []string
+}
+
+var studentTables = []studentTable{
+	{name: "goscrape", written: "lastUpdated", order: []string{"regNumber"}},
+	{name: "gohistory_attendance", written: "scrapedAt", order: []string{"id"}},
+	{name: "gohistory_marks", written: "scrapedAt", order: []string{"id"}},
+	{name: "gogpa", written: "updated_at", order: []string{"regNumber", "semester", "courseCode"}},
+	{name: "gofeed", written: "created_at", order: []string{"regNumber"}},
+	{name: "gocohort_optout", written: "created_at", order: []string{"regNumber"}},
+}
+
+// InactiveStudents returns the registration numbers found in any table keyed
+// by registration number whose latest write, across all of them, is before
+// the given time in milliseconds.
+func (db *DatabaseHelper) InactiveStudents(before int64) ([]string, error) {
+	latest := make(map[string]int64)
+	for _, table := range studentTables {
+		for offset := 0; ; offset += cohortPageSize {
+			query := db.client.From(table.name).Select("regNumber,"+table.written, "", false)
+			for _, column := range table.order {
+				query = query.Order(column, &postgrest.OrderOpts{Ascending: true})
+			}
+
+			var page []map[string]interface{}
+			if _, err := query.Range(offset, offset+cohortPageSize-1, "").ExecuteTo(&page); err != nil {
+				return nil, err
+			}
+			for _, row := range page {
+				written, _ := int64Value(row[table.written])
+				noteWrite(latest, stringValue(row["regNumber"]), written)
+			}
+			if len(page) < cohortPageSize {
+				break
+			}
+		}
+	}
+	return writtenBefore(latest, before), nil
+}
+
+// noteWrite records a write of a student's row, keeping the latest.
+func noteWrite(latest map[string]int64, regNumber string, written int64) {
+	if regNumber == "" {
+		return
+	}
+	if current, ok := latest[regNumber]; !ok || written > current {
+		latest[regNumber] = written
+	}
+}
+
+// writtenBefore returns the students whose latest write is before the given
+// time, sorted.
+func writtenBefore(latest map[string]int64, before int64) []string {
+	var regNumbers []string
+	for regNumber, written := range latest {
+		if written < before {
+			regNumbers = append(regNumbers, regNumber)
+		}
+	}
+	sort.Strings(regNumbers)
+	return regNumbers
+}
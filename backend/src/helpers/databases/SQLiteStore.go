@@ -0,0 +1,905 @@
+package databases
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"goscraper/src/types"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// studentColumns are the goscrape columns the SQLite store knows about.
+var studentColumns = append([]string{"id", "regNumber", "token", "lastUpdated", "ophour", "revision"}, sectionColumns...)
+
+const sqliteSchema = `
+create table if not exists goscrape (
+  "regNumber" text primary key,
+  id text,
+  token text not null default '',
+  "lastUpdated" integer,
+  ophour text default '',
+  revision integer not null default 0,
+  "user" text,
+  timetable text,
+  courses text,
+  attendance text,
+  marks text
+);
+
+create table if not exists gocal (
+  id integer primary key autoincrement,
+  term text,
+  date text,
+  month text,
+  day text,
+  "order" text,
+  event text,
+  created_at integer
+);
+
+create table if not exists gocal_term (
+  term text primary key,
+  hash text not null,
+  updated_at integer
+);
+
+create table if not exists gocal_changes (
+  id integer primary key autoincrement,
+  term text not null,
+  month text not null,
+  date text not null,
+  change text not null,
+  before text,
+  after text,
+  changed_at integer not null
+);
+
+create table if not exists gosession (
+  id text primary key,
+  created_at integer,
+  student text
+);
+
+create table if not exists gofeed (
+  id text primary key,
+  "regNumber" text not null unique,
+  created_at integer
+);
+
+create table if not exists gohistory_attendance (
+  id integer primary key autoincrement,
+  "regNumber" text not null,
+  "courseCode" text not null,
+  category text not null,
+  conducted integer not null,
+  absent integer not null,
+  "scrapedAt" integer not null,
+  payload text
+);
+create index if not exists gohistory_attendance_reg_idx on gohistory_attendance ("regNumber", "scrapedAt");
+
+create table if not exists gohistory_marks (
+  id integer primary key autoincrement,
+  "regNumber" text not null,
+  "courseCode" text not null,
+  "courseType" text not null,
+  test text not null,
+  scored text not null,
+  total real not null,
+  "scrapedAt" integer not null,
+  payload text
+);
+create index if not exists gohistory_marks_reg_idx on gohistory_marks ("regNumber", "scrapedAt");
+
+create table if not exists gogpa (
+  "regNumber" text not null,
+  semester integer not null,
+  "courseCode" text not null,
+  "courseTitle" text,
+  credit real not null,
+  grade text not null,
+  updated_at integer,
+  payload text,
+  primary key ("regNumber", semester, "courseCode")
+);
+
+create table if not exists gocohort_optout (
+  "regNumber" text primary key,
+  created_at integer
+);
+`
+
+// SQLiteStore keeps everything in an embedded SQLite database file, for
+// self-hosted deployments without Supabase.
+type SQLiteStore struct {
+	studentCache
+	db *sql.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time; a single connection avoids
+	// "database is locked" errors under concurrent requests.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &SQLiteStore{db: db}
+	s.studentCache = newStudentCache(s)
+	return s, nil
+}
+
+// migrateSQLite adds columns introduced after a database file was created.
+func migrateSQLite(db *sql.DB) error {
+	for _, statement := range []string{
+		`alter table goscrape add column revision integer not null default 0`,
+		`alter table goscrape add column id text`,
+		`alter table gosession add column student text`,
+		`alter table gocal add column term text`,
+		`alter table gohistory_attendance add column payload text`,
+		`alter table gohistory_marks add column payload text`,
+		`alter table gogpa add column payload text`,
+	} {
+		_, err := db.Exec(statement)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			return err
+		}
+	}
+
+	for _, statement := range []string{
+		`create unique index if not exists goscrape_id_idx on goscrape (id)`,
+		// Planner days stored before terms may be duplicated; the planner is
+		// scraped again on the next request.
+		`delete from gocal where term is null`,
+		`create unique index if not exists gocal_term_idx on gocal (term, month, date)`,
+		// Rows written before registration numbers were normalized; a row
+		// that collides with a normalized one is a duplicate of it.
+		`update gohistory_attendance set "regNumber" = upper(trim("regNumber")) where "regNumber" <> upper(trim("regNumber"))`,
+		`update gohistory_marks set "regNumber" = upper(trim("regNumber")) where "regNumber" <> upper(trim("regNumber"))`,
+		`update or ignore gogpa set "regNumber" = upper(trim("regNumber")) where "regNumber" <> upper(trim("regNumber"))`,
+		`delete from gogpa where "regNumber" <> upper(trim("regNumber"))`,
+		`update or ignore gofeed set "regNumber" = upper(trim("regNumber")) where "regNumber" <> upper(trim("regNumber"))`,
+		`delete from gofeed where "regNumber" <> upper(trim("regNumber"))`,
+		`update or ignore gocohort_optout set "regNumber" = upper(trim("regNumber")) where "regNumber" <> upper(trim("regNumber"))`,
+		`delete from gocohort_optout where "regNumber" <> upper(trim("regNumber"))`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func quoteColumn(column string) string {
+	return `"` + column + `"`
+}
+
+// selectColumns validates a "*" or comma separated column list against
+// studentColumns and returns it quoted.
+func selectColumns(columns string) ([]string, string, error) {
+	var names []string
+	if columns == "*" {
+		names = studentColumns
+	} else {
+		for _, column := range strings.Split(columns, ",") {
+			column = strings.TrimSpace(column)
+			if !isStudentColumn(column) {
+				return nil, "", fmt.Errorf("unknown goscrape column: %s", column)
+			}
+			names = append(names, column)
+		}
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteColumn(name)
+	}
+	return names, strings.Join(quoted, ", "), nil
+}
+
+func isStudentColumn(column string) bool {
+	for _, known := range studentColumns {
+		if known == column {
+			return true
+		}
+	}
+	return false
+}
+
+func scanStudent(rows *sql.Rows, names []string) (map[string]interface{}, error) {
+	values := make([]interface{}, len(names))
+	pointers := make([]interface{}, len(names))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		if bytes, ok := values[i].([]byte); ok {
+			values[i] = string(bytes)
+		}
+		row[name] = values[i]
+	}
+	return row, nil
+}
+
+func (s *SQLiteStore) findStudent(column string, value string, columns string) (map[string]interface{}, error) {
+	if !isStudentColumn(column) {
+		return nil, fmt.Errorf("unknown goscrape column: %s", column)
+	}
+	names, selected, err := selectColumns(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("select "+selected+" from goscrape where "+quoteColumn(column)+" = ? limit 1", value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return scanStudent(rows, names)
+}
+
+func (s *SQLiteStore) insertStudent(row map[string]interface{}) (bool, error) {
+	var columns, placeholders []string
+	var args []interface{}
+	for name, value := range row {
+		if !isStudentColumn(name) {
+			return false, fmt.Errorf("unknown goscrape column: %s", name)
+		}
+		columns = append(columns, quoteColumn(name))
+		placeholders = append(placeholders, "?")
+		args = append(args, value)
+	}
+
+	result, err := s.db.Exec("insert into goscrape ("+strings.Join(columns, ", ")+") values ("+strings.Join(placeholders, ", ")+`) on conflict ("regNumber") do nothing`, args...)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted > 0, err
+}
+
+func (s *SQLiteStore) updateStudent(regNumber string, revision int64, row map[string]interface{}) (bool, error) {
+	var updates []string
+	var args []interface{}
+	for name, value := range row {
+		if !isStudentColumn(name) {
+			return false, fmt.Errorf("unknown goscrape column: %s", name)
+		}
+		updates = append(updates, quoteColumn(name)+" = ?")
+		args = append(args, value)
+	}
+	args = append(args, regNumber, revision)
+
+	result, err := s.db.Exec("update goscrape set "+strings.Join(updates, ", ")+` where "regNumber" = ? and revision = ?`, args...)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+func (s *SQLiteStore) deleteStudent(regNumber string) error {
+	_, err := s.db.Exec(`delete from goscrape where "regNumber" = ?`, regNumber)
+	return err
+}
+
+// InactiveStudents returns the registration numbers found in any table keyed
+// by registration number whose latest write, across all of them, is before
+// the given time in milliseconds.
+func (s *SQLiteStore) InactiveStudents(before int64) ([]string, error) {
+	rows, err := s.db.Query(`select "regNumber" from (
+		select "regNumber", "lastUpdated" as written from goscrape
+		union all select "regNumber", "scrapedAt" from gohistory_attendance
+		union all select "regNumber", "scrapedAt" from gohistory_marks
+		union all select "regNumber", updated_at from gogpa
+		union all select "regNumber", created_at from gofeed
+		union all select "regNumber", created_at from gocohort_optout
+	) where coalesce("regNumber", '') <> ''
+	group by "regNumber" having coalesce(max(written), 0) < ? order by "regNumber"`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var regNumbers []string
+	for rows.Next() {
+		var regNumber string
+		if err := rows.Scan(&regNumber); err != nil {
+			return nil, err
+		}
+		regNumbers = append(regNumbers, regNumber)
+	}
+	return regNumbers, rows.Err()
+}
+
+func (s *SQLiteStore) deleteBlankStudents(regNumber string) (int, error) {
+	result, err := s.db.Exec(`delete from goscrape where "regNumber" = ? or (? = '' and "regNumber" is null)`, regNumber, regNumber)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+func (s *SQLiteStore) studentPage(offset int, limit int, columns string) ([]map[string]interface{}, error) {
+	names, selected, err := selectColumns(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`select `+selected+` from goscrape order by "regNumber" limit ? offset ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var page []map[string]interface{}
+	for rows.Next() {
+		row, err := scanStudent(rows, names)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, row)
+	}
+	return page, rows.Err()
+}
+
+func (s *SQLiteStore) GetCalendarEvents(term string) ([]CalendarEvent, string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	var hash string
+	err = tx.QueryRow(`select hash from gocal_term where term = ?`, term).Scan(&hash)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, "", err
+	}
+
+	rows, err := tx.Query(`select id, term, date, month, day, "order", event, created_at from gocal where term = ?`, term)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var events []CalendarEvent
+	for rows.Next() {
+		var event CalendarEvent
+		if err := rows.Scan(&event.ID, &event.Term, &event.Date, &event.Month, &event.Day, &event.Order, &event.Event, &event.CreatedAt); err != nil {
+			return nil, "", err
+		}
+		events = append(events, event)
+	}
+	return events, hash, rows.Err()
+}
+
+func (s *SQLiteStore) ReplaceCalendarEvents(term string, previousHash string, hash string, events []CalendarEvent, changes []types.CalendarChange) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow(`select hash from gocal_term where term = ?`, term).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	if current != previousHash {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(`delete from gocal where term = ?`, term); err != nil {
+		return false, err
+	}
+	for _, event := range events {
+		_, err := tx.Exec(`insert into gocal (term, date, month, day, "order", event, created_at) values (?, ?, ?, ?, ?, ?, ?)`,
+			term, event.Date, event.Month, event.Day, event.Order, event.Event, event.CreatedAt)
+		if err != nil {
+			return false, err
+		}
+	}
+	for _, change := range changes {
+		before, err := json.Marshal(change.Before)
+		if err != nil {
+			return false, err
+		}
+		after, err := json.Marshal(change.After)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(`insert into gocal_changes (term, month, date, change, before, after, changed_at) values (?, ?, ?, ?, ?, ?, ?)`,
+			term, change.Month, change.Date, change.Change, string(before), string(after), change.ChangedAt)
+		if err != nil {
+			return false, err
+		}
+	}
+	_, err = tx.Exec(`insert into gocal_term (term, hash, updated_at) values (?, ?, ?) on conflict (term) do update set hash = excluded.hash, updated_at = excluded.updated_at`,
+		term, hash, time.Now().UnixNano()/int64(time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *SQLiteStore) GetCalendarChanges(term string, limit int) ([]types.CalendarChange, error) {
+	rows, err := s.db.Query(`select term, month, date, change, before, after, changed_at from gocal_changes where term = ? order by changed_at desc, id desc limit ?`, term, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []types.CalendarChange{}
+	for rows.Next() {
+		var change types.CalendarChange
+		var before, after string
+		if err := rows.Scan(&change.Term, &change.Month, &change.Date, &change.Change, &before, &after, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(before), &change.Before); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(after), &change.After); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func (s *SQLiteStore) AddSession(hash string) error {
+	_, err := s.db.Exec(`insert into gosession (id, created_at) values (?, ?) on conflict (id) do nothing`,
+		hash, time.Now().UnixNano()/int64(time.Millisecond))
+	return err
+}
+
+func (s *SQLiteStore) HasSession(hash string) (bool, error) {
+	var id string
+	err := s.db.QueryRow(`select id from gosession where id = ?`, hash).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SQLiteStore) DeleteSession(hash string) error {
+	_, err := s.db.Exec(`delete from gosession where id = ?`, hash)
+	return err
+}
+
+func (s *SQLiteStore) DeleteAllSessions() error {
+	_, err := s.db.Exec(`delete from gosession`)
+	return err
+}
+
+func (s *SQLiteStore) DeleteSessionsBefore(createdBefore int64) (int, error) {
+	result, err := s.db.Exec(`delete from gosession where created_at < ?`, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+func (s *SQLiteStore) linkSession(sessionHash string, studentID string) error {
+	_, err := s.db.Exec(`update gosession set student = ? where id = ?`, studentID, sessionHash)
+	return err
+}
+
+func (s *SQLiteStore) studentSessions(studentID string) ([]StudentSession, error) {
+	rows, err := s.db.Query(`select id, coalesce(created_at, 0) from gosession where student = ?`, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []StudentSession
+	for rows.Next() {
+		var session StudentSession
+		if err := rows.Scan(&session.ID, &session.CreatedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLiteStore) deleteStudentSessions(studentID string) error {
+	_, err := s.db.Exec(`delete from gosession where student = ?`, studentID)
+	return err
+}
+
+func (s *SQLiteStore) sessionStudent(sessionHash string) (string, error) {
+	var student sql.NullString
+	err := s.db.QueryRow(`select student from gosession where id = ?`, sessionHash).Scan(&student)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return student.String, nil
+}
+
+func (s *SQLiteStore) SetFeed(regNumber string, secretHash string) (*CalendarFeed, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	feed := CalendarFeed{
+		ID:        secretHash,
+		RegNumber: regNumber,
+		CreatedAt: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+
+	_, err := s.db.Exec(`insert into gofeed (id, "regNumber", created_at) values (?, ?, ?)
+		on conflict ("regNumber") do update set id = excluded.id, created_at = excluded.created_at`,
+		feed.ID, feed.RegNumber, feed.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (s *SQLiteStore) FindFeed(secretHash string) (*CalendarFeed, error) {
+	var feed CalendarFeed
+	err := s.db.QueryRow(`select id, "regNumber", created_at from gofeed where id = ?`, secretHash).
+		Scan(&feed.ID, &feed.RegNumber, &feed.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (s *SQLiteStore) FindFeedByRegNumber(regNumber string) (*CalendarFeed, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	var feed CalendarFeed
+	err := s.db.QueryRow(`select id, "regNumber", created_at from gofeed where "regNumber" = ?`, regNumber).
+		Scan(&feed.ID, &feed.RegNumber, &feed.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (s *SQLiteStore) feedRegNumbers() ([]string, error) {
+	rows, err := s.db.Query(`select "regNumber" from gofeed`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var regNumbers []string
+	for rows.Next() {
+		var regNumber string
+		if err := rows.Scan(&regNumber); err != nil {
+			return nil, err
+		}
+		regNumbers = append(regNumbers, regNumber)
+	}
+	return regNumbers, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteFeed(regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	_, err := s.db.Exec(`delete from gofeed where "regNumber" = ?`, regNumber)
+	return err
+}
+
+func (s *SQLiteStore) AddAttendanceSnapshots(snapshots []types.AttendanceSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, snapshot := range snapshots {
+		snapshot, payload, err := s.sealAttendanceSnapshot(snapshot)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`insert into gohistory_attendance ("regNumber", "courseCode", category, conducted, absent, "scrapedAt", payload) values (?, ?, ?, ?, ?, ?, ?)`,
+			snapshot.RegNumber, snapshot.CourseCode, snapshot.Category, snapshot.Conducted, snapshot.Absent, snapshot.ScrapedAt, payload)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetAttendanceSnapshots(regNumber string) ([]types.AttendanceSnapshot, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	rows, err := s.db.Query(`select id, "regNumber", "courseCode", category, conducted, absent, "scrapedAt", coalesce(payload, '')
+		from gohistory_attendance where "regNumber" = ? order by "scrapedAt", id`, regNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []types.AttendanceSnapshot
+	for rows.Next() {
+		var snapshot types.AttendanceSnapshot
+		var payload string
+		if err := rows.Scan(&snapshot.ID, &snapshot.RegNumber, &snapshot.CourseCode, &snapshot.Category, &snapshot.Conducted, &snapshot.Absent, &snapshot.ScrapedAt, &payload); err != nil {
+			return nil, err
+		}
+		if err := s.openAttendanceSnapshot(&snapshot, payload); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+func (s *SQLiteStore) AddMarkSnapshots(snapshots []types.MarkSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, snapshot := range snapshots {
+		snapshot, payload, err := s.sealMarkSnapshot(snapshot)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`insert into gohistory_marks ("regNumber", "courseCode", "courseType", test, scored, total, "scrapedAt", payload) values (?, ?, ?, ?, ?, ?, ?, ?)`,
+			snapshot.RegNumber, snapshot.CourseCode, snapshot.CourseType, snapshot.Test, snapshot.Scored, snapshot.Total, snapshot.ScrapedAt, payload)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetMarkSnapshots(regNumber string) ([]types.MarkSnapshot, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	rows, err := s.db.Query(`select id, "regNumber", "courseCode", "courseType", test, scored, total, "scrapedAt", coalesce(payload, '')
+		from gohistory_marks where "regNumber" = ? order by "scrapedAt", id`, regNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []types.MarkSnapshot
+	for rows.Next() {
+		var snapshot types.MarkSnapshot
+		var payload string
+		if err := rows.Scan(&snapshot.ID, &snapshot.RegNumber, &snapshot.CourseCode, &snapshot.CourseType, &snapshot.Test, &snapshot.Scored, &snapshot.Total, &snapshot.ScrapedAt, &payload); err != nil {
+			return nil, err
+		}
+		if err := s.openMarkSnapshot(&snapshot, payload); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteSnapshots(regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	for _, table := range []string{"gohistory_attendance", "gohistory_marks"} {
+		if _, err := s.db.Exec(`delete from `+table+` where "regNumber" = ?`, regNumber); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) payloadPage(table sealedTable, offset int, limit int) ([]map[string]interface{}, error) {
+	columns := append([]string{}, table.key...)
+	for column := range table.values {
+		columns = append(columns, column)
+	}
+	columns = append(columns, "payload")
+
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteColumn(column)
+	}
+	order := make([]string, len(table.key))
+	for i, column := range table.key {
+		order[i] = quoteColumn(column)
+	}
+
+	rows, err := s.db.Query("select "+strings.Join(quoted, ", ")+" from "+table.name+
+		" order by "+strings.Join(order, ", ")+" limit ? offset ?", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var page []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		page = append(page, row)
+	}
+	return page, rows.Err()
+}
+
+func (s *SQLiteStore) updatePayload(table sealedTable, key map[string]interface{}, previous string, payload string) (bool, error) {
+	updates := []string{"payload = ?"}
+	args := []interface{}{payload}
+	for column, zero := range table.values {
+		updates = append(updates, quoteColumn(column)+" = ?")
+		args = append(args, zero)
+	}
+	conditions := []string{"coalesce(payload, '') = ?"}
+	args = append(args, previous)
+	for _, column := range table.key {
+		conditions = append(conditions, quoteColumn(column)+" = ?")
+		args = append(args, key[column])
+	}
+
+	result, err := s.db.Exec("update "+table.name+" set "+strings.Join(updates, ", ")+
+		" where "+strings.Join(conditions, " and "), args...)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+func (s *SQLiteStore) DeleteAttendanceSnapshotsByID(ids []int64) error {
+	return s.deleteByID("gohistory_attendance", ids)
+}
+
+func (s *SQLiteStore) DeleteMarkSnapshotsByID(ids []int64) error {
+	return s.deleteByID("gohistory_marks", ids)
+}
+
+func (s *SQLiteStore) deleteByID(table string, ids []int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`delete from `+table+` where id = ?`, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetGradeEntries(regNumber string) (map[int][]types.GradeEntry, error) {
+	regNumber = NormalizeRegNumber(regNumber)
+	rows, err := s.db.Query(`select semester, "courseCode", coalesce("courseTitle", ''), credit, grade, coalesce(payload, '') from gogpa where "regNumber" = ?`, regNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make(map[int][]types.GradeEntry)
+	for rows.Next() {
+		var semester int
+		var entry types.GradeEntry
+		var payload string
+		if err := rows.Scan(&semester, &entry.CourseCode, &entry.CourseTitle, &entry.Credit, &entry.Grade, &payload); err != nil {
+			return nil, err
+		}
+		if err := s.openGradeEntry(&entry, payload); err != nil {
+			return nil, err
+		}
+		entries[semester] = append(entries[semester], entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLiteStore) ReplaceSemesterGrades(regNumber string, semester int, entries []types.GradeEntry) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`delete from gogpa where "regNumber" = ? and semester = ?`, regNumber, semester); err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, entry := range entries {
+		payload, err := s.sealGradeEntry(entry)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`insert into gogpa ("regNumber", semester, "courseCode", "courseTitle", credit, grade, updated_at, payload) values (?, ?, ?, '', 0, '', ?, ?)`,
+			regNumber, semester, entry.CourseCode, now, payload)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteSemesterGrades(regNumber string, semester int) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	_, err := s.db.Exec(`delete from gogpa where "regNumber" = ? and semester = ?`, regNumber, semester)
+	return err
+}
+
+func (s *SQLiteStore) DeleteGrades(regNumber string) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	_, err := s.db.Exec(`delete from gogpa where "regNumber" = ?`, regNumber)
+	return err
+}
+
+func (s *SQLiteStore) SetCohortOptOut(regNumber string, optOut bool) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	if !optOut {
+		_, err := s.db.Exec(`delete from gocohort_optout where "regNumber" = ?`, regNumber)
+		return err
+	}
+
+	_, err := s.db.Exec(`insert into gocohort_optout ("regNumber", created_at) values (?, ?) on conflict ("regNumber") do nothing`,
+		regNumber, time.Now().UnixNano()/int64(time.Millisecond))
+	return err
+}
+
+func (s *SQLiteStore) GetCohortOptOuts() (map[string]bool, error) {
+	rows, err := s.db.Query(`select "regNumber" from gocohort_optout`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	optOuts := make(map[string]bool)
+	for rows.Next() {
+		var regNumber string
+		if err := rows.Scan(&regNumber); err != nil {
+			return nil, err
+		}
+		optOuts[NormalizeRegNumber(regNumber)] = true
+	}
+	return optOuts, rows.Err()
+}
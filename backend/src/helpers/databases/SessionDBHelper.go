@@ -0,0 +1,145 @@
+package databases
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SessionHash is how a session token is stored and looked up: its SHA-256 in
+// hex. The token itself is never stored.
+func SessionHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// sessionCacheTTL bounds how long a session found in the database is trusted
+// without asking the database again.
+const sessionCacheTTL = 5 * time.Minute
+
+// sessionCache remembers recently confirmed sessions so that authenticating a
+// request doesn't cost a database round trip.
+type sessionCache struct {
+	seen sync.Map
+}
+
+func (c *sessionCache) has(hash string) bool {
+	until, ok := c.seen.Load(hash)
+	return ok && time.Now().Before(until.(time.Time))
+}
+
+func (c *sessionCache) add(hash string) {
+	c.seen.Store(hash, time.Now().Add(sessionCacheTTL))
+}
+
+func (c *sessionCache) delete(hash string) {
+	c.seen.Delete(hash)
+}
+
+func (c *sessionCache) clear() {
+	c.seen.Range(func(key, _ interface{}) bool {
+		c.seen.Delete(key)
+		return true
+	})
+}
+
+type session struct {
+	ID        string `json:"id"`
+	CreatedAt int64  `json:"created_at"`
+	Student   string `json:"student,omitempty"`
+}
+
+func (db *DatabaseHelper) AddSession(hash string) error {
+	row := session{
+		ID:        hash,
+		CreatedAt: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	_, _, err := db.client.From("gosession").Upsert(row, "id", "", "").Execute()
+	if err != nil {
+		return err
+	}
+	db.sessions.add(hash)
+	return nil
+}
+
+func (db *DatabaseHelper) HasSession(hash string) (bool, error) {
+	if db.sessions.has(hash) {
+		return true, nil
+	}
+
+	var rows []session
+	_, err := db.client.From("gosession").Select("id", "", false).Eq("id", hash).ExecuteTo(&rows)
+	if err != nil {
+		return false, err
+	}
+	if len(rows) == 0 {
+		return false, nil
+	}
+	db.sessions.add(hash)
+	return true, nil
+}
+
+func (db *DatabaseHelper) DeleteSession(hash string) error {
+	db.sessions.delete(hash)
+	_, _, err := db.client.From("gosession").Delete("", "").Eq("id", hash).Execute()
+	return err
+}
+
+func (db *DatabaseHelper) DeleteAllSessions() error {
+	db.sessions.clear()
+	_, _, err := db.client.From("gosession").Delete("", "").Neq("id", "").Execute()
+	return err
+}
+
+func (db *DatabaseHelper) linkSession(sessionHash string, studentID string) error {
+	_, _, err := db.client.From("gosession").Update(map[string]interface{}{"student": studentID}, "minimal", "").Eq("id", sessionHash).Execute()
+	return err
+}
+
+func (db *DatabaseHelper) sessionStudent(sessionHash string) (string, error) {
+	var rows []session
+	_, err := db.client.From("gosession").Select("student", "", false).Eq("id", sessionHash).ExecuteTo(&rows)
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+	return rows[0].Student, nil
+}
+
+func (db *DatabaseHelper) studentSessions(studentID string) ([]StudentSession, error) {
+	var sessions []StudentSession
+	_, err := db.client.From("gosession").Select("id,created_at", "", false).Eq("student", studentID).ExecuteTo(&sessions)
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (db *DatabaseHelper) deleteStudentSessions(studentID string) error {
+	sessions, err := db.studentSessions(studentID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		db.sessions.delete(session.ID)
+	}
+	_, _, err = db.client.From("gosession").Delete("minimal", "").Eq("student", studentID).Execute()
+	return err
+}
+
+// DeleteSessionsBefore removes sessions created before the given time in
+// milliseconds, returning how many were removed.
+func (db *DatabaseHelper) DeleteSessionsBefore(createdBefore int64) (int, error) {
+	_, count, err := db.client.From("gosession").Delete("minimal", "exact").Lt("created_at", strconv.FormatInt(createdBefore, 10)).Execute()
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		db.sessions.clear()
+	}
+	return int(count), nil
+}
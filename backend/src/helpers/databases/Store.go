@@ -0,0 +1,160 @@
+package databases
+
+import (
+	"fmt"
+	"goscraper/src/globals"
+	"goscraper/src/types"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	BackendSupabase = "supabase"
+	BackendSQLite   = "sqlite"
+	BackendMemory   = "memory"
+)
+
+// StudentCache holds each student's scraped data in one row identified by an
+// HMAC of the registration number. Sessions are linked to that row, so any of
+// a student's sessions finds it. sessionHash is SessionHash of the token.
+type StudentCache interface {
+	FindBySession(sessionHash string) (map[string]interface{}, error)
+	FindByRegNumber(regNumber string) (map[string]interface{}, error)
+	UpsertData(sessionHash string, data map[string]interface{}, fetchedAt map[string]int64) error
+	GetOphourBySession(sessionHash string) (string, error)
+	GetCachedSection(sessionHash string, section string) (interface{}, *types.SectionFreshness, error)
+	UpsertDataByKey(sessionHash string, regNumber string, dataKey string, data interface{}, fetchedAt int64) error
+	GetCohortRows() ([]CohortRow, error)
+	Reencrypt() (ReencryptResult, error)
+	Rekey() (RekeyResult, error)
+	StudentSessions(regNumber string) ([]StudentSession, error)
+	LinkSession(sessionHash string, regNumber string) error
+	DeleteStudent(regNumber string) error
+	StudentRegNumbers() ([]string, error)
+	PruneSections(before int64) (int, error)
+	CacheIdentity(sessionHash string) string
+	InvalidateSession(sessionHash string)
+}
+
+// CalendarStore holds the academic planner.
+type CalendarStore interface {
+	GetCalendarEvents(term string) ([]CalendarEvent, string, error)
+	ReplaceCalendarEvents(term string, previousHash string, hash string, events []CalendarEvent, changes []types.CalendarChange) (bool, error)
+	GetCalendarChanges(term string, limit int) ([]types.CalendarChange, error)
+}
+
+// SessionStore holds the SHA-256 hashes of active portal sessions.
+type SessionStore interface {
+	AddSession(hash string) error
+	HasSession(hash string) (bool, error)
+	DeleteSession(hash string) error
+	DeleteAllSessions() error
+	DeleteSessionsBefore(createdBefore int64) (int, error)
+}
+
+type FeedStore interface {
+	SetFeed(regNumber string, secretHash string) (*CalendarFeed, error)
+	FindFeed(secretHash string) (*CalendarFeed, error)
+	FindFeedByRegNumber(regNumber string) (*CalendarFeed, error)
+	DeleteFeed(regNumber string) error
+}
+
+type HistoryStore interface {
+	AddAttendanceSnapshots(snapshots []types.AttendanceSnapshot) error
+	GetAttendanceSnapshots(regNumber string) ([]types.AttendanceSnapshot, error)
+	AddMarkSnapshots(snapshots []types.MarkSnapshot) error
+	GetMarkSnapshots(regNumber string) ([]types.MarkSnapshot, error)
+	DeleteSnapshots(regNumber string) error
+	DeleteAttendanceSnapshotsByID(ids []int64) error
+	DeleteMarkSnapshotsByID(ids []int64) error
+}
+
+type GradeStore interface {
+	GetGradeEntries(regNumber string) (map[int][]types.GradeEntry, error)
+	ReplaceSemesterGrades(regNumber string, semester int, entries []types.GradeEntry) error
+	DeleteSemesterGrades(regNumber string, semester int) error
+	DeleteGrades(regNumber string) error
+}
+
+type CohortStore interface {
+	SetCohortOptOut(regNumber string, optOut bool) error
+	GetCohortOptOuts() (map[string]bool, error)
+}
+
+// RetentionStore looks across every table keyed by registration number, so
+// a student with rows in any of them can be found.
+type RetentionStore interface {
+	InactiveStudents(before int64) ([]string, error)
+}
+
+// Store is everything the handlers persist. Supabase, SQLite and in-memory
+// implementations are available; STORAGE_BACKEND picks one. Registration
+// numbers are normalized by the store, so callers may pass them as scraped.
+type Store interface {
+	StudentCache
+	CalendarStore
+	SessionStore
+	FeedStore
+	HistoryStore
+	GradeStore
+	CohortStore
+	RetentionStore
+}
+
+var (
+	storeOnce sync.Once
+	store     Store
+	storeErr  error
+)
+
+// NewStore returns the process-wide store for the backend named by
+// STORAGE_BACKEND: "supabase" (the default), "sqlite" at SQLITE_PATH, or
+// "memory", which loses everything on restart.
+func NewStore() (Store, error) {
+	storeOnce.Do(func() {
+		if globals.DevMode {
+			godotenv.Load()
+		}
+		store, storeErr = openStore(StorageBackend())
+	})
+	return store, storeErr
+}
+
+// StorageBackend returns the configured backend name.
+func StorageBackend() string {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND")))
+	if backend == "" {
+		return BackendSupabase
+	}
+	return backend
+}
+
+func openStore(backend string) (Store, error) {
+	// Each case checks its own error so a failed open returns a nil Store
+	// rather than an interface holding a nil pointer.
+	switch backend {
+	case BackendSupabase:
+		db, err := NewDatabaseHelper()
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case BackendSQLite:
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "vertex.db"
+		}
+		db, err := NewSQLiteStore(path)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", backend)
+	}
+}
@@ -0,0 +1,455 @@
+package databases
+
+import (
+	"encoding/json"
+	"errors"
+	"goscraper/src/helpers"
+	"goscraper/src/types"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cohortPageSize = 500
+
+// sectionColumns are the goscrape columns holding a cached section as JSON,
+// encrypted at rest when ENCRYPTION_KEY is set.
+var sectionColumns = []string{"user", "timetable", "courses", "attendance", "marks"}
+
+// freshnessKey is the key of a decoded row that reports section freshness. It
+// is not stored.
+const freshnessKey = "freshness"
+
+// cachedSection is how a section is stored: its data with its metadata.
+type cachedSection struct {
+	types.SectionMeta
+	Data interface{} `json:"data"`
+}
+
+// maxWriteAttempts bounds how often a write is retried after losing a race
+// with another write to the same row. Retries back off by a random delay of
+// up to writeBackoff per attempt so racing writers spread out.
+const (
+	maxWriteAttempts = 8
+	writeBackoff     = 20 * time.Millisecond
+)
+
+// ErrWriteConflict is returned when a row kept changing under a write.
+var ErrWriteConflict = errors.New("cached row changed concurrently; write abandoned")
+
+func isMetaColumn(column string) bool {
+	switch column {
+	case "id", "regNumber", "token", "lastUpdated", "ophour", "revision":
+		return true
+	}
+	return false
+}
+
+// studentRows is the storage a backend provides for the goscrape table and the
+// session links pointing into it. Rows hold the student's id, regNumber,
+// lastUpdated, ophour, a revision that every write increments, and one JSON
+// text column per cached section. Rows from before ids may still carry a
+// token column, which is no longer used.
+type studentRows interface {
+	// findStudent returns the columns of the row whose column equals value,
+	// or nil when there is none. columns is "*" or a comma separated list.
+	findStudent(column string, value string, columns string) (map[string]interface{}, error)
+	// insertStudent inserts a new row, reporting false when a row with the
+	// same regNumber already exists.
+	insertStudent(row map[string]interface{}) (bool, error)
+	// updateStudent sets the given columns on the row with regNumber if its
+	// revision still equals revision, reporting false when it doesn't.
+	updateStudent(regNumber string, revision int64, row map[string]interface{}) (bool, error)
+	// deleteStudent removes the row with regNumber.
+	deleteStudent(regNumber string) error
+	// deleteBlankStudents removes the rows whose regNumber is the given blank
+	// value, or null when it is empty, reporting how many it removed.
+	deleteBlankStudents(regNumber string) (int, error)
+	// studentPage returns rows ordered by regNumber.
+	studentPage(offset int, limit int, columns string) ([]map[string]interface{}, error)
+	// linkSession points an existing session at a student id. Unknown
+	// sessions are left alone so a late write can't revive a revoked one.
+	linkSession(sessionHash string, studentID string) error
+	// sessionStudent returns the student id a session points at, or "".
+	sessionStudent(sessionHash string) (string, error)
+	// studentSessions returns the sessions linked to a student id.
+	studentSessions(studentID string) ([]StudentSession, error)
+	// deleteStudentSessions removes every session linked to a student id.
+	deleteStudentSessions(studentID string) error
+	// feedRegNumbers returns the registration numbers with a calendar feed.
+	feedRegNumbers() ([]string, error)
+
+	payloadRows
+}
+
+// studentCache implements StudentCache on top of a backend's studentRows, so
+// every backend encodes and decodes cached sections the same way.
+type studentCache struct {
+	rows  studentRows
+	keys  keyRing
+	idKey []byte
+	links *sync.Map
+}
+
+func newStudentCache(rows studentRows) studentCache {
+	return studentCache{
+		rows:  rows,
+		keys:  loadKeyRing(),
+		idKey: []byte(os.Getenv("CACHE_ID_KEY")),
+		links: &sync.Map{},
+	}
+}
+
+// UpsertData stores the sections in data along with its regNumber and ophour,
+// and links the session to the student. fetchedAt holds when each section was
+// scraped, in milliseconds. data itself is left unchanged.
+func (db *studentCache) UpsertData(sessionHash string, data map[string]interface{}, fetchedAt map[string]int64) error {
+	regNumber, _ := data["regNumber"].(string)
+
+	sections := make(map[string]interface{})
+	fields := make(map[string]interface{})
+	for key, value := range data {
+		switch {
+		case key == "ophour":
+			fields[key] = value
+		case key == freshnessKey || isMetaColumn(key):
+		default:
+			sections[key] = value
+		}
+	}
+
+	return db.writeSections(regNumber, sessionHash, sections, fetchedAt, fields)
+}
+
+// UpsertDataByKey writes one section scraped at fetchedAt, in milliseconds,
+// leaving the student's other sections and their metadata untouched.
+func (db *studentCache) UpsertDataByKey(sessionHash string, regNumber string, dataKey string, data interface{}, fetchedAt int64) error {
+	return db.writeSections(regNumber, sessionHash, map[string]interface{}{dataKey: data}, map[string]int64{dataKey: fetchedAt}, nil)
+}
+
+type sealedSection struct {
+	meta  types.SectionMeta
+	value string
+}
+
+// writeSections stores sections with optimistic concurrency. Each attempt reads
+// the row's revision and writes only if no other write has landed since,
+// retrying otherwise. A section is only replaced by data scraped after the
+// stored copy, going by fetchedAt rather than the time of the write, so a
+// slow or queued refresh can't overwrite a newer one. Sections missing from
+// fetchedAt count as scraped now. Once written, the session is linked to the
+// student.
+func (db *studentCache) writeSections(regNumber string, sessionHash string, sections map[string]interface{}, fetchedAt map[string]int64, fields map[string]interface{}) error {
+	regNumber = NormalizeRegNumber(regNumber)
+	if regNumber == "" {
+		existing, err := db.findBySession(sessionHash, "regNumber")
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return errors.New("no cached row for session and no regNumber given")
+		}
+		regNumber, _ = existing["regNumber"].(string)
+	}
+	id := db.studentID(regNumber)
+
+	sealed := make(map[string]sealedSection, len(sections))
+	columns := []string{"revision"}
+	for section, value := range sections {
+		meta := helpers.NewSectionMeta(section)
+		if at := fetchedAt[section]; at > 0 {
+			meta = helpers.SectionMetaAt(section, at)
+		}
+		value, err := db.sealSection(section, meta, value)
+		if err != nil {
+			return err
+		}
+		sealed[section] = sealedSection{meta: meta, value: value}
+		columns = append(columns, section)
+	}
+
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(rand.Int63n(int64(writeBackoff) * int64(attempt))))
+		}
+
+		row := map[string]interface{}{
+			"id":          id,
+			"lastUpdated": time.Now().UnixNano() / int64(time.Millisecond),
+		}
+		for key, value := range fields {
+			row[key] = value
+		}
+
+		current, err := db.rows.findStudent("regNumber", regNumber, strings.Join(columns, ","))
+		if err != nil {
+			return err
+		}
+
+		if current == nil {
+			row["regNumber"] = regNumber
+			row["revision"] = int64(1)
+			for section, s := range sealed {
+				row[section] = s.value
+			}
+			inserted, err := db.rows.insertStudent(row)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				return db.linkSession(sessionHash, id)
+			}
+			continue
+		}
+
+		for section, s := range sealed {
+			if stored, ok := current[section].(string); ok && stored != "" {
+				if _, meta, err := db.openSection(section, stored); err == nil && meta != nil && meta.FetchedAt > s.meta.FetchedAt {
+					continue
+				}
+			}
+			row[section] = s.value
+		}
+
+		revision, _ := int64Value(current["revision"])
+		row["revision"] = revision + 1
+		updated, err := db.rows.updateStudent(regNumber, revision, row)
+		if err != nil {
+			return err
+		}
+		if updated {
+			return db.linkSession(sessionHash, id)
+		}
+	}
+	return ErrWriteConflict
+}
+
+// sealSection wraps a section with its metadata and seals it for storage.
+func (db *studentCache) sealSection(section string, meta types.SectionMeta, value interface{}) (string, error) {
+	jsonBytes, err := json.Marshal(cachedSection{
+		SectionMeta: meta,
+		Data:        value,
+	})
+	if err != nil {
+		return "", err
+	}
+	return db.keys.seal(section, string(jsonBytes))
+}
+
+// openSection opens a stored section and returns its JSON data and metadata.
+// Sections written before metadata existed return nil metadata.
+func (db *studentCache) openSection(section string, stored string) (json.RawMessage, *types.SectionMeta, error) {
+	plaintext, err := db.keys.open(section, stored)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var wrapped struct {
+		types.SectionMeta
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(plaintext), &wrapped); err == nil && wrapped.FetchedAt > 0 && len(wrapped.Data) > 0 {
+		return wrapped.Data, &wrapped.SectionMeta, nil
+	}
+	return json.RawMessage(plaintext), nil, nil
+}
+
+// FindBySession returns the row of the student a session is linked to.
+func (db *studentCache) FindBySession(sessionHash string) (map[string]interface{}, error) {
+	id, err := db.sessionStudent(sessionHash)
+	if err != nil || id == "" {
+		return nil, err
+	}
+	return db.findOne("id", id)
+}
+
+// FindByRegNumber looks up a cached row by registration number, for callers
+// that don't hold the student's session token.
+func (db *studentCache) FindByRegNumber(regNumber string) (map[string]interface{}, error) {
+	return db.findOne("id", db.studentID(NormalizeRegNumber(regNumber)))
+}
+
+// findBySession returns the columns of the row a session is linked to.
+func (db *studentCache) findBySession(sessionHash string, columns string) (map[string]interface{}, error) {
+	id, err := db.sessionStudent(sessionHash)
+	if err != nil || id == "" {
+		return nil, err
+	}
+	return db.rows.findStudent("id", id, columns)
+}
+
+// findOne returns a decoded row. Its freshnessKey holds the freshness of each
+// cached section.
+func (db *studentCache) findOne(column string, value string) (map[string]interface{}, error) {
+	row, err := db.rows.findStudent(column, value, "*")
+	if err != nil {
+		return nil, err
+	}
+	if row == nil {
+		return nil, nil
+	}
+
+	lastUpdated, _ := int64Value(row["lastUpdated"])
+	now := time.Now()
+	freshness := make(map[string]types.SectionFreshness)
+
+	for key, value := range row {
+		if str, ok := value.(string); ok && !isMetaColumn(key) {
+			data, meta, err := db.openSection(key, str)
+			if err != nil {
+				return nil, err
+			}
+			var jsonData interface{}
+			if err := json.Unmarshal(data, &jsonData); err != nil {
+				return nil, err
+			}
+			row[key] = jsonData
+
+			if meta == nil {
+				meta = &types.SectionMeta{FetchedAt: lastUpdated}
+			}
+			freshness[key] = helpers.SectionFreshness(key, *meta, now)
+		}
+	}
+	row[freshnessKey] = freshness
+
+	return row, nil
+}
+
+func (db *studentCache) GetOphourBySession(sessionHash string) (string, error) {
+	row, err := db.findBySession(sessionHash, "ophour")
+	if err != nil {
+		return "", err
+	}
+	if row == nil {
+		return "", nil
+	}
+
+	ophour, ok := row["ophour"].(string)
+	if !ok {
+		return "", nil
+	}
+	return ophour, nil
+}
+
+// GetCachedSection returns a cached section and its freshness, or nil data
+// when the section isn't cached.
+func (db *studentCache) GetCachedSection(sessionHash string, section string) (interface{}, *types.SectionFreshness, error) {
+	cachedData, err := db.FindBySession(sessionHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, exists := cachedData[section]
+	if !exists || data == nil {
+		return nil, nil, nil
+	}
+
+	sections, _ := cachedData[freshnessKey].(map[string]types.SectionFreshness)
+	freshness, ok := sections[section]
+	if !ok {
+		return data, nil, nil
+	}
+	return data, &freshness, nil
+}
+
+// int64Value reads an integer column as decoded by any backend.
+func int64Value(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// GetCohortRows reads the cached user, attendance and marks of every student,
+// a page at a time.
+func (db *studentCache) GetCohortRows() ([]CohortRow, error) {
+	var rows []CohortRow
+	for offset := 0; ; offset += cohortPageSize {
+		page, err := db.rows.studentPage(offset, cohortPageSize, "regNumber,user,attendance,marks")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, raw := range page {
+			row := CohortRow{}
+			row.RegNumber, _ = raw["regNumber"].(string)
+			db.decodeCached("user", raw["user"], &row.User)
+			db.decodeCached("attendance", raw["attendance"], &row.Attendance)
+			db.decodeCached("marks", raw["marks"], &row.Marks)
+			rows = append(rows, row)
+		}
+
+		if len(page) < cohortPageSize {
+			return rows, nil
+		}
+	}
+}
+
+// PruneSections clears the cached sections of every row last written before
+// the given time in milliseconds, returning how many rows were cleared. The
+// row itself stays, so the student keeps their id and ophour. Students with a
+// calendar feed keep their timetable, which the feed is built from.
+func (db *studentCache) PruneSections(before int64) (int, error) {
+	feeds, err := db.rows.feedRegNumbers()
+	if err != nil {
+		return 0, err
+	}
+	hasFeed := make(map[string]bool, len(feeds))
+	for _, regNumber := range feeds {
+		hasFeed[NormalizeRegNumber(regNumber)] = true
+	}
+
+	pruned := 0
+	columns := "regNumber,lastUpdated,revision," + strings.Join(sectionColumns, ",")
+
+	for offset := 0; ; offset += cohortPageSize {
+		page, err := db.rows.studentPage(offset, cohortPageSize, columns)
+		if err != nil {
+			return pruned, err
+		}
+
+		for _, row := range page {
+			if lastUpdatedOf(row) >= before {
+				continue
+			}
+			update := make(map[string]interface{})
+			keepTimetable := hasFeed[NormalizeRegNumber(stringValue(row["regNumber"]))]
+			for _, column := range sectionColumns {
+				if column == helpers.SectionTimetable && keepTimetable {
+					continue
+				}
+				if row[column] != nil {
+					update[column] = nil
+				}
+			}
+			if len(update) == 0 {
+				continue
+			}
+
+			// A row written since the page was read fails the revision check
+			// and is left alone, which is what pruning wants anyway.
+			revision, _ := int64Value(row["revision"])
+			update["revision"] = revision + 1
+			updated, err := db.rows.updateStudent(stringValue(row["regNumber"]), revision, update)
+			if err != nil {
+				return pruned, err
+			}
+			if updated {
+				pruned++
+			}
+		}
+
+		if len(page) < cohortPageSize {
+			return pruned, nil
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package databases
+
+import (
+	"goscraper/src/types"
+	"sync"
+	"testing"
+)
+
+const testRegNumber = "RA2311003010001"
+
+func storedFetchedAt(t *testing.T, db *MemoryStore, section string) int64 {
+	t.Helper()
+	row, err := db.FindByRegNumber(testRegNumber)
+	if err != nil || row == nil {
+		t.Fatalf("find: %v, %v", row, err)
+	}
+	freshness, _ := row[freshnessKey].(map[string]types.SectionFreshness)
+	return freshness[section].FetchedAt
+}
+
+func TestConcurrentSectionWritesKeepEverySection(t *testing.T) {
+	db := NewMemoryStore()
+	sections := []string{"user", "attendance", "marks", "courses", "timetable"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(sections))
+	for i, section := range sections {
+		wg.Add(1)
+		go func(section string, fetchedAt int64) {
+			defer wg.Done()
+			errs <- db.UpsertDataByKey("", testRegNumber, section, map[string]interface{}{"section": section}, fetchedAt)
+		}(section, int64(1000+i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	row, err := db.FindByRegNumber(testRegNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, section := range sections {
+		data, _ := row[section].(map[string]interface{})
+		if data["section"] != section {
+			t.Errorf("section %s lost: %v", section, row[section])
+		}
+		if got := storedFetchedAt(t, db, section); got != int64(1000+i) {
+			t.Errorf("section %s stamped %d, want the scrape time %d", section, got, 1000+i)
+		}
+	}
+}
+
+func TestOlderScrapeWrittenLaterIsIgnored(t *testing.T) {
+	db := NewMemoryStore()
+
+	if err := db.UpsertDataByKey("", testRegNumber, "marks", map[string]interface{}{"v": "new"}, 2000); err != nil {
+		t.Fatal(err)
+	}
+	// Scraped before the write above but queued behind it
+	if err := db.UpsertDataByKey("", testRegNumber, "marks", map[string]interface{}{"v": "old"}, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := db.FindByRegNumber(testRegNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := row["marks"].(map[string]interface{}); data["v"] != "new" {
+		t.Errorf("older scrape overwrote newer one: %v", row["marks"])
+	}
+	if got := storedFetchedAt(t, db, "marks"); got != 2000 {
+		t.Errorf("fetchedAt = %d, want 2000", got)
+	}
+}
+
+func TestConcurrentWritesOfOneSectionKeepTheNewest(t *testing.T) {
+	db := NewMemoryStore()
+
+	var wg sync.WaitGroup
+	for _, fetchedAt := range []int64{3000, 1000, 4000, 2000} {
+		wg.Add(1)
+		go func(fetchedAt int64) {
+			defer wg.Done()
+			if err := db.UpsertDataByKey("", testRegNumber, "attendance", map[string]interface{}{"at": fetchedAt}, fetchedAt); err != nil {
+				t.Errorf("write %d: %v", fetchedAt, err)
+			}
+		}(fetchedAt)
+	}
+	wg.Wait()
+
+	if got := storedFetchedAt(t, db, "attendance"); got != 4000 {
+		t.Errorf("fetchedAt = %d, want the newest scrape 4000", got)
+	}
+}
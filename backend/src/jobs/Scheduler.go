@@ -0,0 +1,363 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goscraper/src/types"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkers     = 4
+	defaultQueueSize   = 256
+	defaultMaxAttempts = 3
+	defaultBackoff     = time.Second
+	defaultDrain       = 25 * time.Second
+	maxBackoff         = time.Minute
+)
+
+// ErrDrainTimeout is returned by Shutdown when queued work is still running
+// at the deadline. Running jobs are then cancelled through their context.
+var ErrDrainTimeout = errors.New("jobs still running at shutdown deadline")
+
+type task struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+type periodic struct {
+	interval func() time.Duration
+	run      func(ctx context.Context) error
+}
+
+// Scheduler runs named jobs on a bounded pool of workers. Jobs are either
+// periodic, registered with Every, or one-off, submitted with Submit. A job
+// that fails is retried with exponential backoff.
+type Scheduler struct {
+	workers     int
+	maxAttempts int
+	backoff     time.Duration
+
+	queue  chan task
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	loops   sync.WaitGroup
+	running sync.WaitGroup
+
+	mu       sync.Mutex
+	draining bool
+	periodic map[string]periodic
+	status   map[string]*types.JobStatus
+}
+
+var (
+	defaultScheduler *Scheduler
+	defaultOnce      sync.Once
+)
+
+// Default is the process's scheduler, configured from JOB_WORKERS,
+// JOB_QUEUE_SIZE, JOB_MAX_ATTEMPTS and JOB_RETRY_BACKOFF.
+func Default() *Scheduler {
+	defaultOnce.Do(func() {
+		defaultScheduler = New(
+			envInt("JOB_WORKERS", defaultWorkers),
+			envInt("JOB_QUEUE_SIZE", defaultQueueSize),
+			envInt("JOB_MAX_ATTEMPTS", defaultMaxAttempts),
+			envDuration("JOB_RETRY_BACKOFF", defaultBackoff),
+		)
+	})
+	return defaultScheduler
+}
+
+// DrainTimeout is how long shutdown waits for queued jobs, from
+// JOB_DRAIN_TIMEOUT.
+func DrainTimeout() time.Duration {
+	return envDuration("JOB_DRAIN_TIMEOUT", defaultDrain)
+}
+
+// Submit queues a one-off job on the default scheduler.
+func Submit(name string, run func(ctx context.Context) error) bool {
+	return Default().Submit(name, run)
+}
+
+func envInt(name string, fallback int) int {
+	if raw := os.Getenv(name); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			return n
+		}
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if raw := os.Getenv(name); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+// New starts a scheduler with the given number of workers, queue capacity,
+// attempts per job and first retry delay.
+func New(workers int, queueSize int, maxAttempts int, backoff time.Duration) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		workers:     workers,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		queue:       make(chan task, queueSize),
+		stop:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		periodic:    make(map[string]periodic),
+		status:      make(map[string]*types.JobStatus),
+	}
+	s.running.Add(workers)
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+// Every runs a job on every interval, which is read again after each run.
+// With runNow the first run is queued straight away instead of after the
+// first interval. A run is skipped while the previous one is still queued
+// or running.
+func (s *Scheduler) Every(name string, interval func() time.Duration, runNow bool, run func(ctx context.Context) error) {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return
+	}
+	s.periodic[name] = periodic{interval: interval, run: run}
+	status := s.statusOf(name)
+	status.Interval = interval().String()
+	s.loops.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.loops.Done()
+		delay := interval()
+		if runNow {
+			delay = 0
+		}
+		for {
+			s.mu.Lock()
+			status.NextRunAt = millis(time.Now().Add(delay))
+			s.mu.Unlock()
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			s.mu.Lock()
+			busy := status.Queued > 0 || status.Running > 0
+			s.mu.Unlock()
+			if busy {
+				log.Printf("Skipping job %s: previous run has not finished", name)
+			} else {
+				s.Submit(name, run)
+			}
+
+			delay = interval()
+			s.mu.Lock()
+			status.Interval = delay.String()
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// RunNow queues a periodic job outside its schedule. It returns false for an
+// unknown job or when the queue is full.
+func (s *Scheduler) RunNow(name string) bool {
+	s.mu.Lock()
+	job, ok := s.periodic[name]
+	s.mu.Unlock()
+	return ok && s.Submit(name, job.run)
+}
+
+// Submit queues a one-off job. It never blocks: when the queue is full or the
+// scheduler is draining, the job is dropped and Submit returns false.
+func (s *Scheduler) Submit(name string, run func(ctx context.Context) error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.statusOf(name)
+	if s.draining {
+		status.Dropped++
+		return false
+	}
+	select {
+	case s.queue <- task{name: name, run: run}:
+		status.Queued++
+		return true
+	default:
+		status.Dropped++
+		log.Printf("Dropping job %s: queue is full", name)
+		return false
+	}
+}
+
+func (s *Scheduler) work() {
+	defer s.running.Done()
+	for t := range s.queue {
+		s.execute(t)
+	}
+}
+
+// execute runs a job until it succeeds, runs out of attempts or the
+// scheduler is cancelled.
+func (s *Scheduler) execute(t task) {
+	s.mu.Lock()
+	status := s.statusOf(t.name)
+	status.Queued--
+	// Past the shutdown deadline, whatever is still queued is abandoned
+	if s.ctx.Err() != nil {
+		status.Dropped++
+		s.mu.Unlock()
+		return
+	}
+	status.Running++
+	started := time.Now()
+	status.LastStartedAt = millis(started)
+	s.mu.Unlock()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = s.runOnce(t)
+		if err == nil || attempt >= s.maxAttempts || s.ctx.Err() != nil {
+			break
+		}
+
+		s.mu.Lock()
+		status.Retries++
+		s.mu.Unlock()
+
+		timer := time.NewTimer(s.retryDelay(attempt))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+
+	finished := time.Now()
+	s.mu.Lock()
+	status.Running--
+	status.Runs++
+	status.LastFinishedAt = millis(finished)
+	status.LastDurationMs = finished.Sub(started).Milliseconds()
+	status.LastError = ""
+	if err != nil {
+		status.Failures++
+		status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Job %s failed: %v", t.name, err)
+	}
+}
+
+// runOnce runs a single attempt, turning a panic into an error so a bad job
+// can't take a worker down.
+func (s *Scheduler) runOnce(t task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return t.run(s.ctx)
+}
+
+// retryDelay doubles the backoff on every attempt, up to a minute, with up to
+// half of it added as jitter so failed jobs don't retry in lockstep.
+func (s *Scheduler) retryDelay(attempt int) time.Duration {
+	delay := s.backoff << uint(attempt-1)
+	if delay <= 0 || delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// Shutdown stops scheduling periodic jobs, refuses new ones and waits for the
+// queued and running jobs to finish. At the deadline running jobs are
+// cancelled and ErrDrainTimeout is returned.
+func (s *Scheduler) Shutdown(timeout time.Duration) error {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return nil
+	}
+	s.draining = true
+	close(s.stop)
+	close(s.queue)
+	s.mu.Unlock()
+
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-time.After(timeout):
+		s.cancel()
+		return ErrDrainTimeout
+	}
+}
+
+// Status returns every job the scheduler has seen, ordered by name.
+func (s *Scheduler) Status() types.JobsResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response := types.JobsResponse{
+		Workers:       s.workers,
+		QueueLength:   len(s.queue),
+		QueueCapacity: cap(s.queue),
+		Draining:      s.draining,
+		Jobs:          make([]types.JobStatus, 0, len(s.status)),
+	}
+	for _, status := range s.status {
+		response.Jobs = append(response.Jobs, *status)
+	}
+	sort.Slice(response.Jobs, func(i, j int) bool {
+		return response.Jobs[i].Name < response.Jobs[j].Name
+	})
+	return response
+}
+
+// statusOf returns the status of a job, creating it on first use. The caller
+// holds s.mu.
+func (s *Scheduler) statusOf(name string) *types.JobStatus {
+	status, ok := s.status[name]
+	if !ok {
+		status = &types.JobStatus{Name: name}
+		s.status[name] = status
+	}
+	return status
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -1,27 +1,30 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
 	"goscraper/src/globals"
 	"goscraper/src/handlers"
+	"goscraper/src/helpers"
 	"goscraper/src/helpers/databases"
+	"goscraper/src/jobs"
 	"goscraper/src/types"
 	"goscraper/src/utils"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cache"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/etag"
@@ -31,8 +34,10 @@ import (
 )
 
 const (
-	defaultPort = "7860"
-	staticDir   = "../static"
+	defaultPort     = "7860"
+	staticDir       = "../static"
+	shutdownTimeout = 10 * time.Second
+	skipCacheKey    = "skipCache"
 )
 
 func main() {
@@ -41,6 +46,11 @@ func main() {
 	}
 
 	logEnvPresence()
+	if os.Getenv("CACHE_ID_KEY") == "" && !globals.DevMode {
+		log.Fatalf("CACHE_ID_KEY is not set; student ids would be a plain hash of the registration number")
+	}
+	loadDataFiles()
+	handlers.StartJobs()
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -114,11 +124,8 @@ func main() {
 			})
 		}
 
-		// Validate against ActiveSessions
-		hash := sha256.Sum256([]byte(token))
-		hashStr := hex.EncodeToString(hash[:])
-		
-		if _, ok := globals.ActiveSessions.Load(hashStr); !ok {
+		// Validate against the stored sessions
+		if !hasSession(databases.SessionHash(token)) {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Session expired or invalid. Please login again.",
 			})
@@ -167,11 +174,8 @@ func main() {
 			// SRM Cookie Token
 			tokenStr := strings.TrimPrefix(token, "Bearer ")
 			
-			// Validate against ActiveSessions
-			hash := sha256.Sum256([]byte(tokenStr))
-			hashStr := hex.EncodeToString(hash[:])
-			
-			if _, ok := globals.ActiveSessions.Load(hashStr); !ok {
+			// Validate against the stored sessions
+			if !hasSession(databases.SessionHash(tokenStr)) {
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 					"error": "Session expired or invalid. Please login again.",
 				})
@@ -193,17 +197,78 @@ func main() {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
 		}
 
-		// Simple hardcoded key for now, as requested
-		if body.Key != "vertex-admin-secret" {
+		if !isAdminKey(body.Key) {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid admin key"})
 		}
 
 		// Clear all sessions
-		globals.ActiveSessions = sync.Map{}
-		
+		db, err := databases.NewStore()
+		if err != nil {
+			return err
+		}
+		if err := db.DeleteAllSessions(); err != nil {
+			return err
+		}
+		databases.Responses().InvalidateAll()
+
 		return c.JSON(fiber.Map{"message": "All users logged out successfully"})
 	})
 
+	api.Post("/admin/slot-grids/reload", func(c *fiber.Ctx) error {
+		var body struct {
+			Key string `json:"key"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+		}
+
+		if !isAdminKey(body.Key) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid admin key"})
+		}
+
+		config, err := helpers.LoadSlotGrids()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		databases.Responses().InvalidateSection(helpers.SectionTimetable)
+
+		return c.JSON(fiber.Map{
+			"message": "Slot grids reloaded",
+			"version": config.Version,
+			"grids":   len(config.Grids),
+		})
+	})
+
+	api.Post("/admin/jobs", func(c *fiber.Ctx) error {
+		var body struct {
+			Key string `json:"key"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+		}
+
+		if !isAdminKey(body.Key) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid admin key"})
+		}
+
+		return c.JSON(jobs.Default().Status())
+	})
+
+	api.Post("/admin/cache", func(c *fiber.Ctx) error {
+		var body struct {
+			Key string `json:"key"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+		}
+
+		if !isAdminKey(body.Key) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid admin key"})
+		}
+
+		return c.JSON(databases.Responses().Metrics())
+	})
+
 	// Universal error handling middleware
 	app.Use(func(c *fiber.Ctx) error {
 		err := c.Next()
@@ -215,16 +280,6 @@ func main() {
 		return nil
 	})
 
-	cacheConfig := cache.Config{
-		Next: func(c *fiber.Ctx) bool {
-			return c.Method() != "GET"
-		},
-		Expiration: 2 * time.Minute,
-		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.Path() + "_" + c.Get("X-CSRF-Token")
-		},
-	}
-
 	// Routes -----------------------------------------
 
 	api.Get("/health", func(c *fiber.Ctx) error {
@@ -269,6 +324,10 @@ func main() {
 	})
 
 	api.Delete("/logout", func(c *fiber.Ctx) error {
+		if err := handlers.EndSession(c.Get("X-CSRF-Token")); err != nil {
+			log.Printf("Error ending session: %v", err)
+		}
+
 		lf := &handlers.LoginFetcher{}
 		session, err := lf.Logout(c.Get("X-CSRF-Token"))
 		if err != nil {
@@ -277,7 +336,7 @@ func main() {
 		return c.JSON(session)
 	})
 
-	api.Get("/attendance", cache.New(cacheConfig), func(c *fiber.Ctx) error {
+	api.Get("/attendance", studentCache(helpers.SectionAttendance), func(c *fiber.Ctx) error {
 		attendance, err := handlers.GetAttendance(c.Get("X-CSRF-Token"))
 		if err != nil {
 			return err
@@ -285,7 +344,65 @@ func main() {
 		return c.JSON(attendance)
 	})
 
-	api.Get("/marks", cache.New(cacheConfig), func(c *fiber.Ctx) error {
+	api.Get("/attendance/insights", studentCache(helpers.SectionAttendance), func(c *fiber.Ctx) error {
+		insights, err := handlers.GetAttendanceInsights(c.Get("X-CSRF-Token"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(insights)
+	})
+
+	api.Get("/attendance/history", studentCache(helpers.SectionAttendance), func(c *fiber.Ctx) error {
+		history, err := handlers.GetAttendanceHistory(c.Get("X-CSRF-Token"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(history)
+	})
+
+	api.Get("/attendance/forecast", studentCache(helpers.SectionAttendance, helpers.SectionTimetable, handlers.CacheSectionCalendar), func(c *fiber.Ctx) error {
+		skip := c.QueryInt("skip", 0)
+		if skip < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "skip must not be negative"})
+		}
+		forecast, err := handlers.GetAttendanceForecast(c.Get("X-CSRF-Token"), skip)
+		if err != nil {
+			return err
+		}
+		return c.JSON(forecast)
+	})
+
+	api.Get("/attendance/leave-impact", studentCache(helpers.SectionAttendance, helpers.SectionTimetable, handlers.CacheSectionCalendar), func(c *fiber.Ctx) error {
+		from, err := time.ParseInLocation("2006-01-02", c.Query("from"), helpers.PlannerLocation)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid from date, expected YYYY-MM-DD"})
+		}
+		to := from
+		if raw := c.Query("to"); raw != "" {
+			to, err = time.ParseInLocation("2006-01-02", raw, helpers.PlannerLocation)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid to date, expected YYYY-MM-DD"})
+			}
+		}
+		if to.Before(from) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "to must not be before from"})
+		}
+
+		var onDuty []string
+		for _, code := range strings.Split(c.Query("od"), ",") {
+			if code = strings.TrimSpace(code); code != "" {
+				onDuty = append(onDuty, code)
+			}
+		}
+
+		impact, err := handlers.GetLeaveImpact(c.Get("X-CSRF-Token"), from, to, onDuty)
+		if err != nil {
+			return err
+		}
+		return c.JSON(impact)
+	})
+
+	api.Get("/marks", studentCache(helpers.SectionMarks), func(c *fiber.Ctx) error {
 		marks, err := handlers.GetMarks(c.Get("X-CSRF-Token"))
 		if err != nil {
 			return err
@@ -293,7 +410,99 @@ func main() {
 		return c.JSON(marks)
 	})
 
-	api.Get("/courses", cache.New(cacheConfig), func(c *fiber.Ctx) error {
+	api.Get("/marks/events", studentCache(helpers.SectionMarks), func(c *fiber.Ctx) error {
+		var since int64
+		if raw := c.Query("since"); raw != "" {
+			if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				since = ms
+			} else if t, err := time.Parse(time.RFC3339, raw); err == nil {
+				since = t.UnixMilli()
+			} else if t, err := time.ParseInLocation("2006-01-02", raw, helpers.PlannerLocation); err == nil {
+				since = t.UnixMilli()
+			} else {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid since, expected milliseconds, RFC 3339 or YYYY-MM-DD",
+				})
+			}
+		}
+
+		events, err := handlers.GetMarksEvents(c.Get("X-CSRF-Token"), since)
+		if err != nil {
+			return err
+		}
+		return c.JSON(events)
+	})
+
+	api.Get("/marks/targets", studentCache(helpers.SectionMarks), func(c *fiber.Ctx) error {
+		targets, err := handlers.GetMarksTargets(c.Get("X-CSRF-Token"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(targets)
+	})
+
+	// Not cached, so saved grades show up straight away
+	api.Get("/gpa", func(c *fiber.Ctx) error {
+		gpa, err := handlers.GetGPA(c.Get("X-CSRF-Token"), nil)
+		if err != nil {
+			return err
+		}
+		return c.JSON(gpa)
+	})
+
+	api.Post("/gpa/what-if", func(c *fiber.Ctx) error {
+		var body struct {
+			Grades map[string]string `json:"grades"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+		}
+		if err := helpers.ValidateWhatIfGrades(body.Grades); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		gpa, err := handlers.GetGPA(c.Get("X-CSRF-Token"), body.Grades)
+		if err != nil {
+			return err
+		}
+		return c.JSON(gpa)
+	})
+
+	api.Put("/gpa/semesters/:semester", func(c *fiber.Ctx) error {
+		semester, err := c.ParamsInt("semester")
+		if err != nil || semester < 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid semester"})
+		}
+
+		var body struct {
+			Courses []types.GradeEntry `json:"courses"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid body"})
+		}
+		if err := helpers.ValidateGradeEntries(body.Courses); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		gpa, err := handlers.SaveSemesterGrades(c.Get("X-CSRF-Token"), semester, body.Courses)
+		if err != nil {
+			return err
+		}
+		return c.JSON(gpa)
+	})
+
+	api.Delete("/gpa/semesters/:semester", func(c *fiber.Ctx) error {
+		semester, err := c.ParamsInt("semester")
+		if err != nil || semester < 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid semester"})
+		}
+		if err := handlers.DeleteSemesterGrades(c.Get("X-CSRF-Token"), semester); err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"message": "Semester grades deleted"})
+	})
+
+	api.Get("/courses", studentCache(helpers.SectionCourses), func(c *fiber.Ctx) error {
 		courses, err := handlers.GetCourses(c.Get("X-CSRF-Token"))
 		if err != nil {
 			return err
@@ -301,7 +510,7 @@ func main() {
 		return c.JSON(courses)
 	})
 
-	api.Get("/user", cache.New(cacheConfig), func(c *fiber.Ctx) error {
+	api.Get("/user", studentCache(helpers.SectionUser), func(c *fiber.Ctx) error {
 		user, err := handlers.GetUser(c.Get("X-CSRF-Token"))
 		if err != nil {
 			return err
@@ -309,67 +518,183 @@ func main() {
 		return c.JSON(user)
 	})
 
-	api.Get("/calendar", cache.New(cacheConfig), func(c *fiber.Ctx) error {
-		db, err := databases.NewCalDBHelper()
+	api.Get("/calendar", sharedCache(handlers.CacheSectionCalendar), func(c *fiber.Ctx) error {
+		cal, err := handlers.LoadCalendar(c.Get("X-CSRF-Token"))
+		if err != nil {
+			return err
+		}
+		if cal.Error {
+			// Don't share one student's failed scrape with everyone
+			skipCache(c)
+		}
+		return c.JSON(cal)
+	})
+
+	api.Get("/calendar/holidays", sharedCache(handlers.CacheSectionCalendar), func(c *fiber.Ctx) error {
+		holidays, err := handlers.GetHolidays(c.Get("X-CSRF-Token"))
 		if err != nil {
 			return err
 		}
+		return c.JSON(holidays)
+	})
 
-		dbcal, err := db.GetEvents()
+	api.Get("/calendar/upcoming", sharedCache(handlers.CacheSectionCalendar), func(c *fiber.Ctx) error {
+		// Starts from today, so it can't be reused
+		skipCache(c)
+		events, err := handlers.GetUpcomingEvents(c.Get("X-CSRF-Token"), c.Query("type"), c.QueryInt("limit", 0))
 		if err != nil {
 			return err
 		}
+		return c.JSON(events)
+	})
 
-		if len(dbcal.Calendar) == 0 {
-			cal, err := handlers.GetCalendar(c.Get("X-CSRF-Token"))
+	api.Get("/calendar/changes", sharedCache(handlers.CacheSectionCalendar), func(c *fiber.Ctx) error {
+		changes, err := handlers.GetCalendarChanges()
+		if err != nil {
+			return err
+		}
+		return c.JSON(changes)
+	})
+
+	api.Get("/calendar/export.ics", func(c *fiber.Ctx) error {
+		ics, err := handlers.GetICalendar(c.Get("X-CSRF-Token"))
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="timetable.ics"`)
+		return c.SendString(ics)
+	})
+
+	api.Post("/calendar/feed", func(c *fiber.Ctx) error {
+		feed, err := handlers.CreateCalendarFeed(c.Get("X-CSRF-Token"), c.BaseURL())
+		if err != nil {
+			return err
+		}
+		return c.JSON(feed)
+	})
+
+	api.Delete("/calendar/feed", func(c *fiber.Ctx) error {
+		if err := handlers.RevokeCalendarFeed(c.Get("X-CSRF-Token")); err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"message": "Calendar feed revoked"})
+	})
+
+	// Polled by calendar apps, which can't send the session headers. The secret
+	// in the path is the only credential.
+	api.Get("/calendar/feed/:secret", func(c *fiber.Ctx) error {
+		ics, err := handlers.GetCalendarFeed(c.Params("secret"))
+		if errors.Is(err, handlers.ErrFeedNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, handlers.ErrFeedTimetableMissing) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+		return c.SendString(ics)
+	})
+
+	api.Get("/timetable", studentCache(helpers.SectionTimetable), func(c *fiber.Ctx) error {
+		tt, err := handlers.GetTimetableWithTiming(c.Get("X-CSRF-Token"), c.Query("timing"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(tt)
+	})
+
+	api.Get("/timetable/conflicts", studentCache(helpers.SectionTimetable), func(c *fiber.Ctx) error {
+		conflicts, err := handlers.GetTimetableConflicts(c.Get("X-CSRF-Token"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(conflicts)
+	})
+
+	api.Get("/today", studentCache(helpers.SectionTimetable, handlers.CacheSectionCalendar), func(c *fiber.Ctx) error {
+		// Depends on the current time, so it can't be reused
+		skipCache(c)
+		today, err := handlers.GetToday(c.Get("X-CSRF-Token"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(today)
+	})
+
+	api.Get("/schedule", studentCache(helpers.SectionTimetable, handlers.CacheSectionCalendar), func(c *fiber.Ctx) error {
+		date := time.Now().In(helpers.PlannerLocation)
+		raw := c.Query("date")
+		if raw == "" {
+			// Defaults to today, so it can't be reused
+			skipCache(c)
+		} else {
+			parsed, err := time.ParseInLocation("2006-01-02", raw, helpers.PlannerLocation)
 			if err != nil {
-				return err
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid date, expected YYYY-MM-DD",
+				})
 			}
-			go func() {
-				for _, event := range cal.Calendar {
-					for _, month := range event.Days {
-						err = db.SetEvent(databases.CalendarEvent{
-							ID:        utils.GenerateID(),
-							Date:      month.Date,
-							Month:     event.Month,
-							Day:       month.Day,
-							Order:     month.DayOrder,
-							Event:     month.Event,
-							CreatedAt: time.Now().UnixNano() / int64(time.Millisecond),
-						})
-
-						if err != nil {
-							log.Printf("Error setting calendar event: %v", err)
-							return
-						}
-					}
-				}
-			}()
-			return c.JSON(cal)
+			date = parsed
 		}
 
-		return c.JSON(dbcal)
+		schedule, err := handlers.GetSchedule(c.Get("X-CSRF-Token"), date, c.Query("timing"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(schedule)
+	})
 
+	api.Get("/cohort/:courseCode", studentCache(handlers.CacheSectionCohort), func(c *fiber.Ctx) error {
+		cohort, err := handlers.GetCohort(c.Get("X-CSRF-Token"), c.Params("courseCode"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(cohort)
 	})
 
-	api.Get("/timetable", cache.New(cacheConfig), func(c *fiber.Ctx) error {
-		tt, err := handlers.GetTimetable(c.Get("X-CSRF-Token"))
+	api.Post("/cohort/opt-out", func(c *fiber.Ctx) error {
+		if err := handlers.SetCohortOptOut(c.Get("X-CSRF-Token"), true); err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"message": "Opted out of cohort statistics"})
+	})
+
+	api.Delete("/cohort/opt-out", func(c *fiber.Ctx) error {
+		if err := handlers.SetCohortOptOut(c.Get("X-CSRF-Token"), false); err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"message": "Opted back in to cohort statistics"})
+	})
+
+	api.Get("/me/export", func(c *fiber.Ctx) error {
+		export, err := handlers.ExportAccount(c.Get("X-CSRF-Token"))
 		if err != nil {
 			return err
 		}
-		return c.JSON(tt)
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="vertex-export.json"`)
+		return c.JSON(export)
 	})
 
-	api.Get("/get", cache.New(cacheConfig), func(c *fiber.Ctx) error {
+	api.Post("/me/delete", func(c *fiber.Ctx) error {
+		if err := handlers.DeleteAccount(c.Get("X-CSRF-Token")); err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"message": "All of your data has been deleted"})
+	})
+
+	api.Get("/get", studentCache(helpers.Sections...), func(c *fiber.Ctx) error {
 		token := c.Get("X-CSRF-Token")
-		encodedToken := utils.Encode(token)
+		sessionHash := databases.SessionHash(token)
 
-		db, err := databases.NewDatabaseHelper()
+		db, err := databases.NewStore()
 		if err != nil {
 			return err
 		}
 
-		cachedData, err := db.FindByToken("goscrape", encodedToken)
+		cachedData, err := db.FindBySession(sessionHash)
 
 		// Check if cached data exists and all required fields are present and non-empty
 		if len(cachedData) != 0 &&
@@ -378,37 +703,39 @@ func main() {
 			cachedData["marks"] != nil {
 
 			// Always fetch ophour from db and add to cachedData
-			ophour, err := db.GetOphourByToken(encodedToken)
+			ophour, err := db.GetOphourBySession(sessionHash)
 			if err == nil && ophour != "" {
 				cachedData["ophour"] = ophour
 			}
 
-			go func() {
-				data, err := fetchAllData(token)
-				if err != nil {
-					return
-				}
-				if data != nil {
-					data["token"] = encodedToken
-					db.UpsertData("goscrape", data)
-				}
-			}()
+			// Refresh in the background once any section is past its TTL
+			if !allSectionsFresh(cachedData) {
+				jobs.Submit("cache-refresh", func(context.Context) error {
+					data, err := fetchAllData(token, false)
+					if err != nil {
+						return err
+					}
+					if err := db.UpsertData(sessionHash, data, sectionFetchTimes(data)); err != nil {
+						return err
+					}
+					db.InvalidateSession(sessionHash)
+					return nil
+				})
+			}
 
 			return c.JSON(cachedData)
 		}
 
-		data, err := fetchAllData(token)
+		data, err := fetchAllData(token, false)
 		if err != nil {
 			return utils.HandleError(c, err)
 		}
 
-		data["token"] = encodedToken
-
 		js, _ := json.Marshal(data)
 
-		go func() {
-			err = db.UpsertData("goscrape", data)
-		}()
+		jobs.Submit("cache-write", func(context.Context) error {
+			return db.UpsertData(sessionHash, data, sectionFetchTimes(data))
+		})
 
 		var responseData map[string]interface{}
 		if err := json.Unmarshal(js, &responseData); err != nil {
@@ -417,6 +744,27 @@ func main() {
 		return c.JSON(responseData)
 	})
 
+	// Scrapes everything again and drops the student's cached responses
+	api.Post("/refresh", func(c *fiber.Ctx) error {
+		token := c.Get("X-CSRF-Token")
+		sessionHash := databases.SessionHash(token)
+
+		data, err := fetchAllData(token, true)
+		if err != nil {
+			return utils.HandleError(c, err)
+		}
+
+		db, err := databases.NewStore()
+		if err != nil {
+			return err
+		}
+		if err := db.UpsertData(sessionHash, data, sectionFetchTimes(data)); err != nil {
+			return err
+		}
+		db.InvalidateSession(sessionHash)
+		return c.JSON(data)
+	})
+
 	api.Post("/payment/link", func(c *fiber.Ctx) error {
 		var payload handlers.PaymentLinkRequest
 		if err := c.BodyParser(&payload); err != nil {
@@ -468,12 +816,39 @@ func main() {
 		log.Fatalf("Failed to bind: %v", err)
 	}
 	log.Printf("Starting server on port %s...", port)
+
+	// The listener returns as soon as it closes, while requests are still
+	// draining, so jobs are only drained once the server has shut down
+	serverDone := make(chan struct{})
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGTERM, os.Interrupt)
+		<-quit
+		log.Printf("Shutting down, draining requests and jobs...")
+		if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+		close(serverDone)
+	}()
+
 	if err := app.Listener(ln); err != nil {
 		log.Printf("Server error: %+v", err)
+	} else {
+		<-serverDone
+	}
+	if err := jobs.Default().Shutdown(jobs.DrainTimeout()); err != nil {
+		log.Printf("Job shutdown error: %v", err)
 	}
 }
 
-func fetchAllData(token string) (map[string]interface{}, error) {
+// fetchAllData gathers every section, taking still-fresh ones from the store
+// unless scrape is set.
+func fetchAllData(token string, scrape bool) (map[string]interface{}, error) {
+	getAttendance, getMarks, getCourses, getTimetable := handlers.GetAttendance, handlers.GetMarks, handlers.GetCourses, handlers.GetTimetable
+	if scrape {
+		getAttendance, getMarks, getCourses, getTimetable = handlers.ScrapeAttendance, handlers.ScrapeMarks, handlers.ScrapeCourses, handlers.ScrapeTimetable
+	}
+
 	type result struct {
 		key  string
 		data interface{}
@@ -487,40 +862,42 @@ func fetchAllData(token string) (map[string]interface{}, error) {
 		resultChan <- result{"user", data, err}
 	}()
 	go func() {
-		data, err := handlers.GetAttendance(token)
+		data, err := getAttendance(token)
 		resultChan <- result{"attendance", data, err}
 	}()
 	go func() {
-		data, err := handlers.GetMarks(token)
+		data, err := getMarks(token)
 		resultChan <- result{"marks", data, err}
 	}()
 	go func() {
-		data, err := handlers.GetCourses(token)
+		data, err := getCourses(token)
 		resultChan <- result{"courses", data, err}
 	}()
 	go func() {
-		data, err := handlers.GetTimetable(token)
+		data, err := getTimetable(token)
 		resultChan <- result{"timetable", data, err}
 	}()
 
 	data := make(map[string]interface{})
+	freshness := make(map[string]*types.SectionFreshness)
 	for i := 0; i < 5; i++ {
 		r := <-resultChan
 		if r.err != nil {
 			return nil, r.err
 		}
 		data[r.key] = r.data
+		freshness[r.key] = sectionFreshness(r.key, r.data)
 	}
 
 	if user, ok := data["user"].(*types.User); ok {
 		data["regNumber"] = user.RegNumber
 	}
+	data["freshness"] = freshness
 
 	// Fetch ophour from database
-	db, err := databases.NewDatabaseHelper()
+	db, err := databases.NewStore()
 	if err == nil {
-		encodedToken := utils.Encode(token)
-		ophour, err := db.GetOphourByToken(encodedToken)
+		ophour, err := db.GetOphourBySession(databases.SessionHash(token))
 		if err == nil && ophour != "" {
 			data["ophour"] = ophour
 		}
@@ -529,17 +906,166 @@ func fetchAllData(token string) (map[string]interface{}, error) {
 	return data, nil
 }
 
+// sectionFreshness returns the freshness a section's handler reported, which
+// carries when the section was scraped. The user section is always scraped.
+func sectionFreshness(section string, data interface{}) *types.SectionFreshness {
+	var freshness *types.SectionFreshness
+	switch v := data.(type) {
+	case *types.AttendanceResponse:
+		freshness = v.Freshness
+	case *types.MarksResponse:
+		freshness = v.Freshness
+	case *types.CourseResponse:
+		freshness = v.Freshness
+	case *types.TimetableResult:
+		freshness = v.Freshness
+	}
+	if freshness == nil {
+		freshness = helpers.FreshSection(section)
+	}
+	return freshness
+}
+
+// sectionFetchTimes returns when each section of data from fetchAllData was
+// scraped, in milliseconds.
+func sectionFetchTimes(data map[string]interface{}) map[string]int64 {
+	fetchedAt := make(map[string]int64)
+	if freshness, ok := data["freshness"].(map[string]*types.SectionFreshness); ok {
+		for section, f := range freshness {
+			if f != nil {
+				fetchedAt[section] = f.FetchedAt
+			}
+		}
+	}
+	return fetchedAt
+}
+
+// studentCache caches a GET route's responses per student, tagged with the
+// sections they are built from.
+func studentCache(sections ...string) fiber.Handler {
+	return cacheResponses(false, sections)
+}
+
+// sharedCache caches a GET route's responses once for everyone, for routes
+// that don't depend on who is asking.
+func sharedCache(sections ...string) fiber.Handler {
+	return cacheResponses(true, sections)
+}
+
+// skipCache keeps the current response out of the response cache.
+func skipCache(c *fiber.Ctx) {
+	c.Locals(skipCacheKey, true)
+}
+
+func cacheResponses(shared bool, sections []string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet {
+			return c.Next()
+		}
+
+		identity := ""
+		if !shared {
+			db, err := databases.NewStore()
+			if err != nil {
+				return c.Next()
+			}
+			identity = db.CacheIdentity(databases.SessionHash(c.Get("X-CSRF-Token")))
+		}
+
+		responses := databases.Responses()
+		variant := c.OriginalURL()
+		cached, generation, ok := responses.Get(identity, variant)
+		if ok {
+			c.Set("X-Cache", "HIT")
+			c.Set(fiber.HeaderContentType, cached.ContentType)
+			return c.Status(cached.Status).Send(cached.Body)
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		c.Set("X-Cache", "MISS")
+		if c.Response().StatusCode() == fiber.StatusOK && c.Locals(skipCacheKey) == nil {
+			responses.Set(identity, variant, sections, databases.CachedResponse{
+				Status:      fiber.StatusOK,
+				ContentType: string(c.Response().Header.ContentType()),
+				Body:        append([]byte(nil), c.Response().Body()...),
+			}, generation)
+		}
+		return nil
+	}
+}
+
+// hasSession reports whether the session hash belongs to a logged-in user.
+func hasSession(hashStr string) bool {
+	db, err := databases.NewStore()
+	if err != nil {
+		return false
+	}
+	ok, err := db.HasSession(hashStr)
+	return err == nil && ok
+}
+
+// allSectionsFresh reports whether every section of a cached row is within
+// its TTL.
+func allSectionsFresh(cachedData map[string]interface{}) bool {
+	freshness, ok := cachedData["freshness"].(map[string]types.SectionFreshness)
+	if !ok {
+		return false
+	}
+	for _, section := range helpers.Sections {
+		if !freshness[section].Fresh {
+			return false
+		}
+	}
+	return true
+}
+
 func isPublicRoute(path string) bool {
+	if strings.HasPrefix(path, "/api/calendar/feed/") {
+		return true
+	}
+
 	switch path {
-	case "/api/login", "/api/health", "/api/admin/logout-all":
+	case "/api/login", "/api/health", "/api/admin/logout-all", "/api/admin/slot-grids/reload", "/api/admin/jobs", "/api/admin/cache":
 		return true
 	default:
 		return false
 	}
 }
 
+// isAdminKey checks a key against ADMIN_KEY. Admin calls are refused while
+// ADMIN_KEY isn't set.
+func isAdminKey(key string) bool {
+	adminKey := os.Getenv("ADMIN_KEY")
+	if adminKey == "" || key == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1
+}
+
+func loadDataFiles() {
+	if err := helpers.LoadCalendarRules(); err != nil {
+		log.Printf("[WARN] calendar rules: %v", err)
+	}
+	if config, err := helpers.LoadSlotGrids(); err != nil {
+		log.Printf("[WARN] slot grids: %v", err)
+	} else {
+		log.Printf("[INFO] slot grids %s loaded (%d grids)", config.Version, len(config.Grids))
+		if len(config.ParallelCourses) == 0 {
+			log.Printf("[WARN] slot grids %s list no parallel courses; shared slots are only exempt from clashes when every course is optional", config.Version)
+		}
+	}
+	if _, err := helpers.LoadAttendancePolicy(); err != nil {
+		log.Printf("[WARN] attendance policy: %v", err)
+	}
+	if _, err := helpers.LoadGradingModel(); err != nil {
+		log.Printf("[WARN] grading model: %v", err)
+	}
+}
+
 func logEnvPresence() {
-	required := []string{"VALIDATION_KEY", "SUPABASE_URL", "SUPABASE_ANON_KEY", "PORT"}
+	required := []string{"VALIDATION_KEY", "ENCRYPTION_KEY", "CACHE_ID_KEY", "SUPABASE_URL", "SUPABASE_ANON_KEY", "PORT"}
 	for _, key := range required {
 		if os.Getenv(key) == "" {
 			if key == "PORT" {
@@ -551,6 +1077,12 @@ func logEnvPresence() {
 			log.Printf("[INFO] %s detected", key)
 		}
 	}
+	if os.Getenv("ENCRYPTION_KEY") == "" && databases.StorageBackend() != databases.BackendMemory {
+		log.Printf("[WARN] ENCRYPTION_KEY is not set; sections will be stored UNENCRYPTED in the %s backend", databases.StorageBackend())
+	}
+	if os.Getenv("ADMIN_KEY") == "" {
+		log.Printf("[WARN] ADMIN_KEY is not set; admin endpoints are disabled")
+	}
 }
 
 func ensureStaticIndex(indexPath string) {
@@ -0,0 +1,23 @@
+package types
+
+type SessionExport struct {
+	CreatedAt int64 `json:"createdAt"`
+	Current   bool  `json:"current"`
+}
+
+type PreferencesExport struct {
+	CohortOptOut   bool   `json:"cohortOptOut"`
+	CalendarFeedAt *int64 `json:"calendarFeedCreatedAt,omitempty"`
+}
+
+// AccountExport is everything stored about a student.
+type AccountExport struct {
+	ExportedAt        int64                  `json:"exportedAt"`
+	RegNumber         string                 `json:"regNumber"`
+	Cache             map[string]interface{} `json:"cache"`
+	Sessions          []SessionExport        `json:"sessions"`
+	Preferences       PreferencesExport      `json:"preferences"`
+	Grades            map[int][]GradeEntry   `json:"grades"`
+	AttendanceHistory []AttendanceSnapshot   `json:"attendanceHistory"`
+	MarksHistory      []MarkSnapshot         `json:"marksHistory"`
+}
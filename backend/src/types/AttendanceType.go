@@ -1,20 +1,172 @@
 package types
 
 type Attendance struct {
-	CourseCode           string `json:"courseCode"`
-	CourseTitle          string `json:"courseTitle"`
-	Category             string `json:"category"`
-	FacultyName          string `json:"facultyName"`
-	Slot                 string `json:"slot"`
-	HoursConducted       string `json:"hoursConducted"`
-	HoursAbsent          string `json:"hoursAbsent"`
-	AttendancePercentage string `json:"attendancePercentage"`
+	CourseCode           string            `json:"courseCode"`
+	CourseTitle          string            `json:"courseTitle"`
+	Category             string            `json:"category"`
+	FacultyName          string            `json:"facultyName"`
+	Slot                 string            `json:"slot"`
+	HoursConducted       string            `json:"hoursConducted"`
+	HoursAbsent          string            `json:"hoursAbsent"`
+	AttendancePercentage string            `json:"attendancePercentage"`
+	Margin               *AttendanceMargin `json:"margin,omitempty"`
+}
+
+// AttendanceMargin is how far a course is from its attendance threshold.
+// Required is the number of consecutive classes needed to get back to the
+// threshold; Skippable is how many can be missed while staying at or above it.
+type AttendanceMargin struct {
+	Threshold  float64 `json:"threshold"`
+	Attended   int     `json:"attended"`
+	Conducted  int     `json:"conducted"`
+	Percentage float64 `json:"percentage"`
+	Required   int     `json:"required"`
+	Skippable  int     `json:"skippable"`
+	Safe       bool    `json:"safe"`
+}
+
+type AttendanceInsight struct {
+	CourseCode  string           `json:"courseCode"`
+	CourseTitle string           `json:"courseTitle"`
+	Category    string           `json:"category"`
+	Slot        string           `json:"slot"`
+	Margin      AttendanceMargin `json:"margin"`
+}
+
+type AttendanceInsightsResponse struct {
+	RegNumber string              `json:"regNumber"`
+	Threshold float64             `json:"threshold"`
+	Courses   []AttendanceInsight `json:"courses"`
+	AtRisk    int                 `json:"atRisk"`
+	Stale     bool                `json:"stale,omitempty"`
 }
 
 type AttendanceResponse struct {
-	RegNumber  string       `json:"regNumber"`
-	Attendance []Attendance `json:"attendance"`
-	Status     int          `json:"status,omitempty"`
-	Error      string       `json:"error,omitempty"`
-	Stale      bool         `json:"stale,omitempty"`
+	RegNumber  string            `json:"regNumber"`
+	Attendance []Attendance      `json:"attendance"`
+	Status     int               `json:"status,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Stale      bool              `json:"stale,omitempty"`
+	Freshness  *SectionFreshness `json:"freshness,omitempty"`
+}
+
+const (
+	ScenarioAttendAll   = "attend_all"
+	ScenarioCurrentRate = "current_rate"
+	ScenarioSkip        = "skip"
+)
+
+// AttendanceScenario is the attendance a course ends the semester with if the
+// remaining classes go a particular way.
+type AttendanceScenario struct {
+	Name           string  `json:"name"`
+	Skipped        int     `json:"skipped"`
+	Attended       int     `json:"attended"`
+	Conducted      int     `json:"conducted"`
+	Percentage     float64 `json:"percentage"`
+	MeetsThreshold bool    `json:"meetsThreshold"`
+}
+
+type CourseForecast struct {
+	CourseCode        string               `json:"courseCode"`
+	CourseTitle       string               `json:"courseTitle"`
+	Category          string               `json:"category"`
+	Threshold         float64              `json:"threshold"`
+	Attended          int                  `json:"attended"`
+	Conducted         int                  `json:"conducted"`
+	RemainingHours    int                  `json:"remainingHours"`
+	MaxSkippable      int                  `json:"maxSkippable"`
+	CanReachThreshold bool                 `json:"canReachThreshold"`
+	Scenarios         []AttendanceScenario `json:"scenarios"`
+}
+
+type AttendanceForecastResponse struct {
+	RegNumber     string           `json:"regNumber"`
+	From          string           `json:"from"`
+	Until         string           `json:"until"`
+	RemainingDays int              `json:"remainingDays"`
+	Skip          int              `json:"skip"`
+	Courses       []CourseForecast `json:"courses"`
+	Unreachable   []string         `json:"unreachable"`
+	Stale         bool             `json:"stale,omitempty"`
+}
+
+// CourseLeaveImpact is what a leave costs one course. ProjectedPercentage is
+// the attendance at the end of the leave, assuming every class before it is
+// attended; EndOfSemesterPercentage also assumes every class after it is.
+type CourseLeaveImpact struct {
+	CourseCode              string  `json:"courseCode"`
+	CourseTitle             string  `json:"courseTitle"`
+	Category                string  `json:"category"`
+	Threshold               float64 `json:"threshold"`
+	CurrentPercentage       float64 `json:"currentPercentage"`
+	MissedHours             int     `json:"missedHours"`
+	OnDutyHours             int     `json:"onDutyHours"`
+	ProjectedPercentage     float64 `json:"projectedPercentage"`
+	EndOfSemesterPercentage float64 `json:"endOfSemesterPercentage"`
+	DropsBelowThreshold     bool    `json:"dropsBelowThreshold"`
+	CanRecover              bool    `json:"canRecover"`
+}
+
+type LeaveImpactResponse struct {
+	RegNumber      string              `json:"regNumber"`
+	From           string              `json:"from"`
+	To             string              `json:"to"`
+	Days           []string            `json:"days"`
+	OnDuty         []string            `json:"onDuty"`
+	Courses        []CourseLeaveImpact `json:"courses"`
+	BelowThreshold []string            `json:"belowThreshold"`
+	Stale          bool                `json:"stale,omitempty"`
+}
+
+// AttendanceSnapshot is one course's attendance counts as of a scrape.
+// Snapshots are only stored when the counts change.
+type AttendanceSnapshot struct {
+	ID         int64  `json:"id,omitempty"`
+	RegNumber  string `json:"regNumber"`
+	CourseCode string `json:"courseCode"`
+	Category   string `json:"category"`
+	Conducted  int    `json:"conducted"`
+	Absent     int    `json:"absent"`
+	ScrapedAt  int64  `json:"scrapedAt"`
+}
+
+type AttendancePoint struct {
+	ScrapedAt  int64   `json:"scrapedAt"`
+	Date       string  `json:"date"`
+	Conducted  int     `json:"conducted"`
+	Absent     int     `json:"absent"`
+	Percentage float64 `json:"percentage"`
+}
+
+type AttendanceSeries struct {
+	CourseCode  string            `json:"courseCode"`
+	CourseTitle string            `json:"courseTitle"`
+	Category    string            `json:"category"`
+	Points      []AttendancePoint `json:"points"`
+}
+
+const (
+	AttendanceEventCourseAdded    = "course_added"
+	AttendanceEventHoursConducted = "hours_conducted"
+	AttendanceEventAbsentMarked   = "absent_marked"
+	AttendanceEventAbsentRemoved  = "absent_removed"
+)
+
+// AttendanceEvent is a change between two consecutive snapshots of a course.
+type AttendanceEvent struct {
+	Type       string `json:"type"`
+	CourseCode string `json:"courseCode"`
+	Category   string `json:"category"`
+	Delta      int    `json:"delta"`
+	Date       string `json:"date"`
+	ScrapedAt  int64  `json:"scrapedAt"`
+	Message    string `json:"message"`
+}
+
+type AttendanceHistoryResponse struct {
+	RegNumber string             `json:"regNumber"`
+	Courses   []AttendanceSeries `json:"courses"`
+	Events    []AttendanceEvent  `json:"events"`
+	Stale     bool               `json:"stale,omitempty"`
 }
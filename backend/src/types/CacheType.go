@@ -0,0 +1,28 @@
+package types
+
+// MemoryCacheMetrics describes the in-process response cache.
+type MemoryCacheMetrics struct {
+	Hits          int64   `json:"hits"`
+	Misses        int64   `json:"misses"`
+	HitRate       float64 `json:"hitRate"`
+	Evictions     int64   `json:"evictions"`
+	Expirations   int64   `json:"expirations"`
+	Invalidations int64   `json:"invalidations"`
+	Entries       int     `json:"entries"`
+	Bytes         int64   `json:"bytes"`
+	MaxEntries    int     `json:"maxEntries"`
+	MaxBytes      int64   `json:"maxBytes"`
+}
+
+// StoreCacheMetrics counts reads answered by fresh sections in the
+// persistent store instead of a scrape.
+type StoreCacheMetrics struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hitRate"`
+}
+
+type CacheMetrics struct {
+	Memory MemoryCacheMetrics `json:"memory"`
+	Store  StoreCacheMetrics  `json:"store"`
+}
@@ -1,10 +1,21 @@
 package types
 
+const (
+	DayCategoryHoliday        = "holiday"
+	DayCategoryExam           = "exam"
+	DayCategoryLastWorkingDay = "last_working_day"
+	DayCategoryEnrollment     = "enrollment"
+	DayCategoryWorkingDay     = "working_day"
+	DayCategoryWeekend        = "weekend"
+	DayCategoryNoDayOrder     = "no_day_order"
+)
+
 type Day struct {
-	Date     string `json:"date"`
-	Day      string `json:"day"`
-	Event    string `json:"event"`
-	DayOrder string `json:"dayOrder"`
+	Date       string   `json:"date"`
+	Day        string   `json:"day"`
+	Event      string   `json:"event"`
+	DayOrder   string   `json:"dayOrder"`
+	Categories []string `json:"categories,omitempty"`
 }
 
 type CalendarMonth struct {
@@ -21,3 +32,49 @@ type CalendarResponse struct {
 	Index    int             `json:"index"`
 	Calendar []CalendarMonth `json:"calendar"`
 }
+
+// CalendarEntry is a single planner day with a resolved ISO date.
+type CalendarEntry struct {
+	Date       string   `json:"date"`
+	Month      string   `json:"month"`
+	Day        string   `json:"day"`
+	DayOrder   string   `json:"dayOrder"`
+	Event      string   `json:"event"`
+	Categories []string `json:"categories"`
+}
+
+type CalendarEventsResponse struct {
+	Type   string          `json:"type,omitempty"`
+	Events []CalendarEntry `json:"events"`
+	Status int             `json:"status"`
+}
+
+type CalendarFeedResponse struct {
+	URL       string `json:"url"`
+	WebcalURL string `json:"webcalUrl"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+const (
+	CalendarChangeAdded   = "added"
+	CalendarChangeUpdated = "updated"
+	CalendarChangeRemoved = "removed"
+)
+
+// CalendarChange is a planner day that was added, changed or removed when the
+// planner was refreshed. Before and After hold the day on either side.
+type CalendarChange struct {
+	Term      string `json:"term"`
+	Month     string `json:"month"`
+	Date      string `json:"date"`
+	Change    string `json:"change"`
+	Before    *Day   `json:"before,omitempty"`
+	After     *Day   `json:"after,omitempty"`
+	ChangedAt int64  `json:"changedAt"`
+}
+
+type CalendarChangesResponse struct {
+	Term    string           `json:"term"`
+	Changes []CalendarChange `json:"changes"`
+	Status  int              `json:"status"`
+}
@@ -0,0 +1,41 @@
+package types
+
+// CohortStat summarises one value across the students of a cohort. It is only
+// published when at least the minimum number of students contributed.
+type CohortStat struct {
+	Contributors int     `json:"contributors"`
+	Mean         float64 `json:"mean"`
+	Median       float64 `json:"median"`
+	P25          float64 `json:"p25"`
+	P75          float64 `json:"p75"`
+}
+
+type CohortAttendanceStat struct {
+	Category string     `json:"category"`
+	Stat     CohortStat `json:"stat"`
+}
+
+type CohortTestStat struct {
+	CourseType string     `json:"courseType"`
+	Test       string     `json:"test"`
+	Total      float64    `json:"total"`
+	Stat       CohortStat `json:"stat"`
+}
+
+// CohortGroup holds the published aggregates of a course, either across all
+// students or within one section.
+type CohortGroup struct {
+	Section      string                 `json:"section,omitempty"`
+	Contributors int                    `json:"contributors"`
+	Attendance   []CohortAttendanceStat `json:"attendance"`
+	Tests        []CohortTestStat       `json:"tests"`
+}
+
+type CohortResponse struct {
+	CourseCode      string       `json:"courseCode"`
+	Course          *CohortGroup `json:"course"`
+	Section         *CohortGroup `json:"section"`
+	MinContributors int          `json:"minContributors"`
+	GeneratedAt     int64        `json:"generatedAt"`
+	OptedOut        bool         `json:"optedOut"`
+}
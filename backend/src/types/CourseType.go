@@ -15,9 +15,10 @@ type Course struct {
 }
 
 type CourseResponse struct {
-	RegNumber string   `json:"regNumber"`
-	Courses   []Course `json:"courses"`
-	Status    int      `json:"status,omitempty"`
-	Error     string   `json:"error,omitempty"`
-	Stale     bool     `json:"stale,omitempty"`
+	RegNumber string            `json:"regNumber"`
+	Courses   []Course          `json:"courses"`
+	Status    int               `json:"status,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Stale     bool              `json:"stale,omitempty"`
+	Freshness *SectionFreshness `json:"freshness,omitempty"`
 }
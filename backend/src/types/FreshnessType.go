@@ -0,0 +1,17 @@
+package types
+
+// SectionMeta describes how a cached section was obtained.
+type SectionMeta struct {
+	FetchedAt     int64  `json:"fetchedAt"`
+	Source        string `json:"source"`
+	ParserVersion string `json:"parserVersion"`
+}
+
+// SectionFreshness reports a section's age against its TTL. A section is
+// fresh while it is younger than the TTL and was parsed by the current parser.
+type SectionFreshness struct {
+	SectionMeta
+	AgeSeconds int64 `json:"ageSeconds"`
+	TTLSeconds int64 `json:"ttlSeconds"`
+	Fresh      bool  `json:"fresh"`
+}
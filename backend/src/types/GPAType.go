@@ -0,0 +1,34 @@
+package types
+
+const (
+	GradeSourceEntered = "entered"
+	GradeSourceWhatIf  = "what_if"
+)
+
+// GradeEntry is a course's grade in a semester. Courses of the current
+// semester without a grade are listed with an empty Grade and left out of
+// the GPA.
+type GradeEntry struct {
+	CourseCode  string  `json:"courseCode"`
+	CourseTitle string  `json:"courseTitle"`
+	Credit      float64 `json:"credit"`
+	Grade       string  `json:"grade"`
+	Points      int     `json:"points"`
+	Source      string  `json:"source,omitempty"`
+}
+
+type SemesterGPA struct {
+	Semester int          `json:"semester"`
+	Credits  float64      `json:"credits"`
+	SGPA     float64      `json:"sgpa"`
+	Courses  []GradeEntry `json:"courses"`
+}
+
+type GPAResponse struct {
+	RegNumber       string        `json:"regNumber"`
+	CurrentSemester int           `json:"currentSemester"`
+	Semesters       []SemesterGPA `json:"semesters"`
+	Credits         float64       `json:"credits"`
+	CGPA            float64       `json:"cgpa"`
+	Stale           bool          `json:"stale,omitempty"`
+}
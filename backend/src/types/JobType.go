@@ -0,0 +1,27 @@
+package types
+
+// JobStatus is what the scheduler knows about a named job. Periodic jobs
+// have an interval and a next run; jobs submitted by requests don't.
+type JobStatus struct {
+	Name           string `json:"name"`
+	Interval       string `json:"interval,omitempty"`
+	Running        int    `json:"running"`
+	Queued         int    `json:"queued"`
+	Runs           int64  `json:"runs"`
+	Failures       int64  `json:"failures"`
+	Retries        int64  `json:"retries"`
+	Dropped        int64  `json:"dropped"`
+	LastStartedAt  int64  `json:"lastStartedAt,omitempty"`
+	LastFinishedAt int64  `json:"lastFinishedAt,omitempty"`
+	LastDurationMs int64  `json:"lastDurationMs,omitempty"`
+	LastError      string `json:"lastError,omitempty"`
+	NextRunAt      int64  `json:"nextRunAt,omitempty"`
+}
+
+type JobsResponse struct {
+	Workers       int         `json:"workers"`
+	QueueLength   int         `json:"queueLength"`
+	QueueCapacity int         `json:"queueCapacity"`
+	Draining      bool        `json:"draining"`
+	Jobs          []JobStatus `json:"jobs"`
+}
@@ -19,9 +19,85 @@ type Mark struct {
 }
 
 type MarksResponse struct {
-	RegNumber string `json:"regNumber"`
-	Marks     []Mark `json:"marks"`
-	Status    int    `json:"status"`
-	Error     string `json:"error,omitempty"`
-	Stale     bool   `json:"stale,omitempty"`
+	RegNumber string            `json:"regNumber"`
+	Marks     []Mark            `json:"marks"`
+	Status    int               `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	Stale     bool              `json:"stale,omitempty"`
+	Freshness *SectionFreshness `json:"freshness,omitempty"`
+}
+
+// GradeTarget is the end-semester score needed for a grade given the internal
+// marks so far. Required is in end-semester weightage; RequiredRaw is out of
+// the end-semester paper's maximum.
+type GradeTarget struct {
+	Grade       string  `json:"grade"`
+	Points      int     `json:"points"`
+	Required    float64 `json:"required"`
+	RequiredRaw float64 `json:"requiredRaw"`
+	Secured     bool    `json:"secured"`
+	Achievable  bool    `json:"achievable"`
+}
+
+type MarksWarning struct {
+	Test    string `json:"test,omitempty"`
+	Message string `json:"message"`
+}
+
+type CourseMarksTargets struct {
+	CourseCode        string         `json:"courseCode"`
+	CourseName        string         `json:"courseName"`
+	CourseType        string         `json:"courseType"`
+	InternalScored    float64        `json:"internalScored"`
+	InternalPublished float64        `json:"internalPublished"`
+	InternalMax       float64        `json:"internalMax"`
+	EndSemWeight      float64        `json:"endSemWeight"`
+	EndSemMax         float64        `json:"endSemMax"`
+	Targets           []GradeTarget  `json:"targets"`
+	Warnings          []MarksWarning `json:"warnings"`
+}
+
+type MarksTargetsResponse struct {
+	RegNumber string               `json:"regNumber"`
+	Courses   []CourseMarksTargets `json:"courses"`
+	Stale     bool                 `json:"stale,omitempty"`
+}
+
+// MarkSnapshot is one test's score as of a scrape. Snapshots are only stored
+// when a test appears or its score changes.
+type MarkSnapshot struct {
+	ID         int64   `json:"id,omitempty"`
+	RegNumber  string  `json:"regNumber"`
+	CourseCode string  `json:"courseCode"`
+	CourseType string  `json:"courseType"`
+	Test       string  `json:"test"`
+	Scored     string  `json:"scored"`
+	Total      float64 `json:"total"`
+	ScrapedAt  int64   `json:"scrapedAt"`
+}
+
+const (
+	MarksEventTestPublished = "test_published"
+	MarksEventScoreChanged  = "score_changed"
+)
+
+type MarksEvent struct {
+	Type           string  `json:"type"`
+	CourseCode     string  `json:"courseCode"`
+	CourseName     string  `json:"courseName"`
+	CourseType     string  `json:"courseType"`
+	Test           string  `json:"test"`
+	Scored         string  `json:"scored"`
+	Total          float64 `json:"total"`
+	PreviousScored string  `json:"previousScored,omitempty"`
+	Date           string  `json:"date"`
+	ScrapedAt      int64   `json:"scrapedAt"`
+	Message        string  `json:"message"`
+}
+
+type MarksEventsResponse struct {
+	RegNumber string       `json:"regNumber"`
+	Since     int64        `json:"since"`
+	Events    []MarksEvent `json:"events"`
+	Stale     bool         `json:"stale,omitempty"`
 }
@@ -0,0 +1,35 @@
+package types
+
+const (
+	ScheduleStatusClasses      = "classes"
+	ScheduleStatusHoliday      = "holiday"
+	ScheduleStatusNoDayOrder   = "no_day_order"
+	ScheduleStatusNotInPlanner = "not_in_planner"
+)
+
+type ScheduledClass struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	Slot       string `json:"slot"`
+	RoomNo     string `json:"roomNo"`
+	CourseType string `json:"courseType"`
+	Online     bool   `json:"online"`
+	Period     int    `json:"period"`
+	Span       int    `json:"span"`
+	StartTime  string `json:"startTime"`
+	EndTime    string `json:"endTime"`
+}
+
+type ScheduleResponse struct {
+	Date       string           `json:"date"`
+	Day        string           `json:"day"`
+	DayOrder   string           `json:"dayOrder"`
+	Status     string           `json:"status"`
+	Event      string           `json:"event,omitempty"`
+	Categories []string         `json:"categories"`
+	Timing     string           `json:"timing,omitempty"`
+	Classes    []ScheduledClass `json:"classes"`
+	Current    *ScheduledClass  `json:"current"`
+	Next       *ScheduledClass  `json:"next"`
+	Stale      bool             `json:"stale,omitempty"`
+}
@@ -7,8 +7,37 @@ type Slot struct {
 }
 
 type Batch struct {
-	Batch string `json:"batch"`
-	Slots []Slot `json:"slots"`
+	Batch   string `json:"batch"`
+	Program string `json:"program,omitempty"`
+	Campus  string `json:"campus,omitempty"`
+	Timing  string `json:"timing,omitempty"`
+	Slots   []Slot `json:"slots"`
+}
+
+type Period struct {
+	Period int    `json:"period"`
+	Start  string `json:"start"`
+	End    string `json:"end"`
+}
+
+type Break struct {
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type TimingProfile struct {
+	Periods []Period `json:"periods"`
+	Breaks  []Break  `json:"breaks,omitempty"`
+}
+
+type SlotGridConfig struct {
+	Version         string                   `json:"version"`
+	SlotCodes       []string                 `json:"slotCodes"`
+	PracticalPrefix string                   `json:"practicalPrefix"`
+	Timings         map[string]TimingProfile `json:"timings"`
+	ParallelCourses [][]string               `json:"parallelCourses,omitempty"`
+	Grids           []Batch                  `json:"grids"`
 }
 
 type TableSlot struct {
@@ -19,16 +48,78 @@ type TableSlot struct {
 	CourseType string `json:"courseType"`
 	Online     bool   `json:"online"`
 	IsOptional bool   `json:"isOptional"`
+	Period     int    `json:"period"`
+	StartTime  string `json:"startTime"`
+	EndTime    string `json:"endTime"`
+	Conflict   bool   `json:"conflict,omitempty"`
+}
+
+// SlotConflict reports courses registered in the same slot that aren't known
+// to run in parallel.
+type SlotConflict struct {
+	Slot      string   `json:"slot"`
+	DayOrders []int    `json:"dayOrders"`
+	Codes     []string `json:"codes"`
+	Names     []string `json:"names"`
+	Message   string   `json:"message"`
+}
+
+const (
+	CellKindFree     = "free"
+	CellKindClass    = "class"
+	CellKindLab      = "lab"
+	CellKindElective = "elective"
+)
+
+// TimetableCell is one entry in a day's table. Free and class cells cover a
+// single period, lab cells cover a block of consecutive practical periods and
+// elective cells offer a choice between the parallel courses in Options.
+type TimetableCell struct {
+	Kind string `json:"kind"`
+	TableSlot
+	Span    int         `json:"span"`
+	Slots   []string    `json:"slots"`
+	Options []TableSlot `json:"options,omitempty"`
 }
 
 type DaySchedule struct {
-	Day   int         `json:"day"`
-	Table []interface{} `json:"table"`
+	Day   int             `json:"day"`
+	Table []TimetableCell `json:"table"`
+}
+
+const (
+	BatchSourceInferred = "inferred"
+	BatchSourceProfile  = "profile"
+	BatchSourceDefault  = "default"
+)
+
+// BatchResolution explains which slot grid was used for the timetable.
+type BatchResolution struct {
+	Batch        string             `json:"batch"`
+	Source       string             `json:"source"`
+	Confidence   float64            `json:"confidence"`
+	Reason       string             `json:"reason"`
+	ProfileBatch string             `json:"profileBatch"`
+	Scores       map[string]float64 `json:"scores"`
 }
 
 type TimetableResult struct {
-	RegNumber string        `json:"regNumber"`
-	Batch     string        `json:"batch"`
-	Schedule  []DaySchedule `json:"schedule"`
-	Stale     bool          `json:"stale,omitempty"`
+	RegNumber   string            `json:"regNumber"`
+	Batch       string            `json:"batch"`
+	Resolution  *BatchResolution  `json:"batchResolution,omitempty"`
+	GridVersion string            `json:"gridVersion,omitempty"`
+	Timing      string            `json:"timing"`
+	Periods     []Period          `json:"periods"`
+	Breaks      []Break           `json:"breaks,omitempty"`
+	Schedule    []DaySchedule     `json:"schedule"`
+	Conflicts   []SlotConflict    `json:"conflicts,omitempty"`
+	Stale       bool              `json:"stale,omitempty"`
+	Freshness   *SectionFreshness `json:"freshness,omitempty"`
+}
+
+type TimetableConflictsResponse struct {
+	RegNumber    string         `json:"regNumber"`
+	HasConflicts bool           `json:"hasConflicts"`
+	Conflicts    []SlotConflict `json:"conflicts"`
+	Stale        bool           `json:"stale,omitempty"`
 }
@@ -11,4 +11,5 @@ type User struct {
 	Department string `json:"department"`
 	Section    string `json:"section"`
 	Specialization string `json:"specialization"`
+	Campus     string `json:"campus,omitempty"`
 }